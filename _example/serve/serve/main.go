@@ -13,7 +13,7 @@ import (
 func main() {
 	logs := glog.New()
 	r := gin.New()
-	r.Use(logger.NewErrorLogger(logger.WithWriterErrorFn(func(c *gin.Context, log *logger.LogFormatterParams) (int, interface{}) {
+	r.Use(logger.NewErrorLogger(logger.WithLogger(logs), logger.WithWriterErrorFn(func(c *gin.Context, log *logger.LogFormatterParams) (int, interface{}) {
 		//fmt.Println(log)
 		return 0, "网络超时, 请重试!"
 	})))
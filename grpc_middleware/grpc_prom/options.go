@@ -1,7 +1,9 @@
 package grpc_prom
 
 import (
+	"github.com/donetkit/contrib-gin/pkg/hll"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
 )
@@ -22,6 +24,7 @@ type config struct {
 	endpointLabelMappingFn  RequestLabelMappingFn
 
 	counterOpts []CounterOption
+	visitors    *hll.Estimator
 }
 
 // Option for queue system
@@ -83,11 +86,15 @@ func WithEndpointLabelMappingFn(endpointLabelMappingFn RequestLabelMappingFn) Op
 	}
 }
 
-//WithPromHandler set router function
+// WithPromHandler set router function, the metrics are served in the
+// OpenMetrics format to the scrapers asking for it, with their exemplars
 func WithPromHandler(r *http.ServeMux) Option {
 	return func(cfg *config) {
 		if r != nil {
-			r.Handle(cfg.handlerUrl, promhttp.Handler())
+			r.Handle(cfg.handlerUrl, promhttp.InstrumentMetricHandler(
+				prometheus.DefaultRegisterer,
+				promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+			))
 		}
 	}
 }
@@ -112,3 +119,11 @@ func WithCounterOption(counterOpts []CounterOption) Option {
 		cfg.counterOpts = counterOpts
 	}
 }
+
+// WithUniqueVisitors count the peer IPs of the RPCs with estimator, it is
+// registered by RegisterServer
+func WithUniqueVisitors(estimator *hll.Estimator) Option {
+	return func(cfg *config) {
+		cfg.visitors = estimator
+	}
+}
@@ -53,6 +53,9 @@ func RegisterServer(server *grpc.Server, opts ...Option) {
 	prom.MustRegister(DefaultServerMetrics.serverStreamMsgReceived)
 	prom.MustRegister(DefaultServerMetrics.serverStreamMsgSent)
 	prom.MustRegister(DefaultServerMetrics.serverHandledUptime)
+	if cfg.visitors != nil {
+		prom.MustRegister(cfg.visitors)
+	}
 
 	DefaultServerMetrics.InitializeMetrics(server)
 	go DefaultServerMetrics.recordUptime()
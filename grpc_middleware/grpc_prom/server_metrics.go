@@ -4,10 +4,12 @@ import (
 	"context"
 	"github.com/donetkit/contrib-gin/grpc_middleware/grpc_prom/grpcstatus"
 	prom "github.com/prometheus/client_golang/prometheus"
+	"net"
 	"regexp"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
 )
 
 var (
@@ -111,7 +113,8 @@ func (m *ServerMetrics) checkLabel(label string, patterns []string) bool {
 // EnableHandlingTimeHistogram enables histograms being registered when
 // registering the ServerMetrics on a Prometheus registry. Histograms can be
 // expensive on Prometheus servers. It takes options to configure histogram
-// options such as the defined buckets.
+// options such as the defined buckets. The handling times carry the trace ID
+// of the span an interceptor ahead, such as grpc_trace, started as exemplar.
 func (m *ServerMetrics) EnableHandlingTimeHistogram(opts ...HistogramOption) {
 	for _, o := range opts {
 		o(&m.serverHandledHistogramOpts)
@@ -154,7 +157,8 @@ func (m *ServerMetrics) Collect(ch chan<- prom.Metric) {
 // UnaryServerInterceptor is a gRPC server-side interceptor that provides Prometheus monitoring for Unary RPCs.
 func (m *ServerMetrics) UnaryServerInterceptor() func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		monitor := newServerReporter(m, Unary, info.FullMethod)
+		m.addVisitor(ctx)
+		monitor := newServerReporter(ctx, m, Unary, info.FullMethod)
 		monitor.ReceivedMessage()
 		resp, err := handler(ctx, req)
 		st, _ := grpcstatus.FromError(err)
@@ -169,7 +173,8 @@ func (m *ServerMetrics) UnaryServerInterceptor() func(ctx context.Context, req i
 // StreamServerInterceptor is a gRPC server-side interceptor that provides Prometheus monitoring for Streaming RPCs.
 func (m *ServerMetrics) StreamServerInterceptor() func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		monitor := newServerReporter(m, streamRPCType(info), info.FullMethod)
+		m.addVisitor(ss.Context())
+		monitor := newServerReporter(ss.Context(), m, streamRPCType(info), info.FullMethod)
 		err := handler(srv, &monitoredServerStream{ss, monitor})
 		st, _ := grpcstatus.FromError(err)
 		monitor.Handled(st.Code())
@@ -189,6 +194,22 @@ func (m *ServerMetrics) InitializeMetrics(server *grpc.Server) {
 	}
 }
 
+// addVisitor counts the peer IP of an RPC when WithUniqueVisitors is set
+func (m *ServerMetrics) addVisitor(ctx context.Context) {
+	if m.config == nil || m.config.visitors == nil {
+		return
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	m.config.visitors.Add(addr)
+}
+
 func streamRPCType(info *grpc.StreamServerInfo) grpcType {
 	if info.IsClientStream && !info.IsServerStream {
 		return ClientStream
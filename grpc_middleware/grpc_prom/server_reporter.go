@@ -4,12 +4,14 @@
 package grpc_prom
 
 import (
+	"context"
 	"time"
 
 	"google.golang.org/grpc/codes"
 )
 
 type serverReporter struct {
+	ctx         context.Context
 	metrics     *ServerMetrics
 	rpcType     grpcType
 	serviceName string
@@ -18,8 +20,9 @@ type serverReporter struct {
 	lvs         []string
 }
 
-func newServerReporter(m *ServerMetrics, rpcType grpcType, fullMethod string) *serverReporter {
+func newServerReporter(ctx context.Context, m *ServerMetrics, rpcType grpcType, fullMethod string) *serverReporter {
 	r := &serverReporter{
+		ctx:     ctx,
 		metrics: m,
 		rpcType: rpcType,
 	}
@@ -62,6 +65,6 @@ func (r *serverReporter) Handled(code codes.Code) {
 	}
 	r.metrics.serverHandledCounter.WithLabelValues(string(r.rpcType), r.serviceName, r.methodName, code.String()).Inc()
 	if r.metrics.serverHandledHistogramEnabled {
-		r.metrics.serverHandledHistogram.WithLabelValues(r.lvs...).Observe(time.Since(r.startTime).Seconds())
+		observe(r.ctx, r.metrics.serverHandledHistogram.WithLabelValues(r.lvs...), time.Since(r.startTime).Seconds())
 	}
 }
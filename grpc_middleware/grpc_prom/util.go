@@ -4,8 +4,11 @@
 package grpc_prom
 
 import (
+	"context"
 	"strings"
 
+	prom "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 )
@@ -48,3 +51,14 @@ func typeFromMethodInfo(mInfo *grpc.MethodInfo) grpcType {
 	}
 	return BidiStream
 }
+
+// observe records v on observer with the trace ID of the span of ctx as
+// exemplar, such as the one grpc_trace starts, when the span is sampled
+func observe(ctx context.Context, observer prom.Observer, v float64) {
+	sc := trace.SpanContextFromContext(ctx)
+	if eo, ok := observer.(prom.ExemplarObserver); ok && sc.IsSampled() {
+		eo.ObserveWithExemplar(v, prom.Labels{"trace_id": sc.TraceID().String()})
+		return
+	}
+	observer.Observe(v)
+}
@@ -3,7 +3,10 @@
 
 //`grpc_recovery` are interceptors that recover from gRPC handler panics.
 //Server Side Recovery Middleware
-//By default a panic will be converted into a gRPC error with `code.Internal`.
+//By default a panic will be converted into a gRPC error with `code.Internal`, a generic message and an
+//`errdetails.ErrorInfo` carrying the panic fingerprint, never the panic value itself.
+//Panics are reported to the `recovery.Pipeline` given with `WithPipeline`, the one of the gin middleware, so panics of
+//both transports end up in one stream of events.
 //Handling can be customised by providing an alternate grpc_recovery function.
 //Please see examples for simple examples of use.
 
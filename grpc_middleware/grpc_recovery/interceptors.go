@@ -5,12 +5,18 @@ package grpc_recovery
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// PanicReason is the reason of the ErrorInfo detail of recovered panics
+const PanicReason = "PANIC"
+
 // RecoveryHandlerFunc is a function that recovers from the panic `p` by returning an `error`.
 type RecoveryHandlerFunc func(p interface{}) (err error)
 
@@ -26,7 +32,7 @@ func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
 
 		defer func() {
 			if r := recover(); r != nil || panicked {
-				err = recoverFrom(ctx, r, o.recoveryHandlerFunc)
+				err = o.recoverFrom(ctx, info.FullMethod, r)
 			}
 		}()
 
@@ -44,7 +50,7 @@ func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
 
 		defer func() {
 			if r := recover(); r != nil || panicked {
-				err = recoverFrom(stream.Context(), r, o.recoveryHandlerFunc)
+				err = o.recoverFrom(stream.Context(), info.FullMethod, r)
 			}
 		}()
 
@@ -54,9 +60,48 @@ func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
 	}
 }
 
-func recoverFrom(ctx context.Context, p interface{}, r RecoveryHandlerFuncContext) error {
-	if r == nil {
-		return status.Errorf(codes.Internal, "%v", p)
+// recoverFrom reports p to the pipeline, then returns the error of the
+// recovery handler or a sanitized codes.Internal status
+func (o *options) recoverFrom(ctx context.Context, method string, p interface{}) error {
+	e := o.pipeline.Capture(ctx, p)
+	e.Transport = "grpc"
+	e.Route = method
+	o.pipeline.Report(e)
+
+	if o.recoveryHandlerFunc != nil {
+		return o.recoveryHandlerFunc(ctx, p)
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason:   PanicReason,
+		Domain:   serviceOf(method),
+		Metadata: map[string]string{"fingerprint": e.Fingerprint},
+	}
+	if e.RequestID != "" {
+		info.Metadata["request_id"] = e.RequestID
+	}
+	st := status.New(codes.Internal, "internal error")
+	if !o.debug {
+		if withDetails, err := st.WithDetails(info); err == nil {
+			st = withDetails
+		}
+		return st.Err()
+	}
+	debug := &errdetails.DebugInfo{Detail: e.Message}
+	for _, f := range e.Frames {
+		debug.StackEntries = append(debug.StackEntries, fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line))
+	}
+	if withDetails, err := st.WithDetails(info, debug); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// serviceOf returns the service of a full method such as /pkg.Service/Method
+func serviceOf(method string) string {
+	method = strings.TrimPrefix(method, "/")
+	if i := strings.LastIndexByte(method, '/'); i >= 0 {
+		return method[:i]
 	}
-	return r(ctx, p)
+	return method
 }
@@ -0,0 +1,79 @@
+package grpc_recovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/donetkit/contrib-gin/middleware/recovery"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var info = &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Method"}
+
+func panicking(ctx context.Context, req interface{}) (interface{}, error) {
+	panic("secret internals")
+}
+
+func TestSanitizedStatus(t *testing.T) {
+	_, err := UnaryServerInterceptor()(context.Background(), nil, info, panicking)
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.NotContains(t, st.Message(), "secret")
+	if assert.Len(t, st.Details(), 1) {
+		errInfo := st.Details()[0].(*errdetails.ErrorInfo)
+		assert.Equal(t, PanicReason, errInfo.Reason)
+		assert.Equal(t, "pkg.Service", errInfo.Domain)
+		assert.Len(t, errInfo.Metadata["fingerprint"], 16)
+	}
+}
+
+func TestDebugInfo(t *testing.T) {
+	_, err := UnaryServerInterceptor(WithDebugInfo(true))(context.Background(), nil, info, panicking)
+
+	st := status.Convert(err)
+	if assert.Len(t, st.Details(), 2) {
+		debug := st.Details()[1].(*errdetails.DebugInfo)
+		assert.Equal(t, "secret internals", debug.Detail)
+		assert.Contains(t, debug.StackEntries[0], "grpc_recovery.panicking")
+	}
+}
+
+func TestSharedPipeline(t *testing.T) {
+	var events []*recovery.Event
+	pipeline := recovery.NewPipeline(recovery.WithReporter(recovery.ReporterFunc(func(e *recovery.Event) {
+		events = append(events, e)
+	})))
+
+	_, err := UnaryServerInterceptor(WithPipeline(pipeline))(context.Background(), nil, info, panicking)
+	assert.Error(t, err)
+
+	r := gin.New()
+	r.Use(pipeline.Handler())
+	r.GET("/", func(c *gin.Context) {
+		panic("secret internals")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "grpc", events[0].Transport)
+		assert.Equal(t, "/pkg.Service/Method", events[0].Route)
+		assert.Equal(t, "http", events[1].Transport)
+		assert.Equal(t, "/", events[1].Route)
+	}
+}
+
+func TestRecoveryHandler(t *testing.T) {
+	_, err := UnaryServerInterceptor(WithRecoveryHandler(func(p interface{}) error {
+		return status.Errorf(codes.Unavailable, "%v", p)
+	}))(context.Background(), nil, info, panicking)
+
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -3,7 +3,11 @@
 
 package grpc_recovery
 
-import "context"
+import (
+	"context"
+
+	"github.com/donetkit/contrib-gin/middleware/recovery"
+)
 
 var (
 	defaultOptions = &options{
@@ -13,6 +17,8 @@ var (
 
 type options struct {
 	recoveryHandlerFunc RecoveryHandlerFuncContext
+	pipeline            *recovery.Pipeline
+	debug               bool
 }
 
 func evaluateOptions(opts []Option) *options {
@@ -21,6 +27,9 @@ func evaluateOptions(opts []Option) *options {
 	for _, o := range opts {
 		o(optCopy)
 	}
+	if optCopy.pipeline == nil {
+		optCopy.pipeline = recovery.NewPipeline()
+	}
 	return optCopy
 }
 
@@ -41,3 +50,19 @@ func WithRecoveryHandlerContext(f RecoveryHandlerFuncContext) Option {
 		o.recoveryHandlerFunc = f
 	}
 }
+
+// WithPipeline reports panics to the recovery.Pipeline of the gin middleware, so panics of both transports share the
+// reporters, fingerprints and rate limit.
+func WithPipeline(p *recovery.Pipeline) Option {
+	return func(o *options) {
+		o.pipeline = p
+	}
+}
+
+// WithDebugInfo attaches the panic message and stack as an errdetails.DebugInfo to the returned status. Only enable it
+// in development, it leaks internals to clients.
+func WithDebugInfo(debug bool) Option {
+	return func(o *options) {
+		o.debug = debug
+	}
+}
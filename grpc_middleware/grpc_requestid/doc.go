@@ -0,0 +1,18 @@
+/*
+`grpc_requestid` carries the request id of the requestid middleware across gRPC calls.
+
+Client interceptors copy the id found with requestid.FromContext into the outgoing metadata, server interceptors
+read it back from the incoming metadata, or generate one, and store it with requestid.NewContext. A handler of a gin
+service calling a gRPC service, which calls another gin service through a requestid.Transport, logs the same id
+at every hop.
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpc_requestid.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(grpc_requestid.StreamServerInterceptor()),
+	)
+	conn, err := grpc.Dial(addr,
+		grpc.WithUnaryInterceptor(grpc_requestid.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(grpc_requestid.StreamClientInterceptor()),
+	)
+*/
+package grpc_requestid
@@ -0,0 +1,75 @@
+package grpc_requestid
+
+import (
+	"context"
+
+	"github.com/donetkit/contrib-gin/grpc_middleware"
+	"github.com/donetkit/contrib-gin/grpc_middleware/util/metautils"
+	"github.com/donetkit/contrib-gin/middleware/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryClientInterceptor returns a new unary client interceptor that sends the request id of the context.
+func UnaryClientInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
+	o := evaluateOptions(opts)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		return invoker(o.outgoing(ctx), method, req, reply, cc, callOpts...)
+	}
+}
+
+// StreamClientInterceptor returns a new streaming client interceptor that sends the request id of the context.
+func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	o := evaluateOptions(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(o.outgoing(ctx), desc, cc, method, callOpts...)
+	}
+}
+
+// UnaryServerInterceptor returns a new unary server interceptor that stores the request id of the call in the context.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	o := evaluateOptions(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(o.incoming(ctx), req)
+	}
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor that stores the request id of the call in the context.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	o := evaluateOptions(opts)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = o.incoming(stream.Context())
+		return handler(srv, wrapped)
+	}
+}
+
+// outgoing adds the id to the outgoing metadata unless the caller set one
+func (o *options) outgoing(ctx context.Context) context.Context {
+	id := requestid.FromContext(ctx)
+	if id == "" {
+		return ctx
+	}
+	md := metautils.ExtractOutgoing(ctx)
+	if md.Get(o.metadataKey) != "" {
+		return ctx
+	}
+	return md.Clone().Set(o.metadataKey, id).ToOutgoing(ctx)
+}
+
+// incoming stores the valid id of the call, or a new one, and echoes it in the response header
+func (o *options) incoming(ctx context.Context) context.Context {
+	id := metautils.ExtractIncoming(ctx).Get(o.metadataKey)
+	if id != "" && !o.valid(id) {
+		id = ""
+	}
+	if id == "" && o.generator != nil {
+		id = o.generator()
+	}
+	if id == "" {
+		return ctx
+	}
+	// fails outside of a grpc server, there is no header to set
+	_ = grpc.SetHeader(ctx, metadata.Pairs(o.metadataKey, id))
+	return requestid.NewContext(ctx, id)
+}
@@ -0,0 +1,58 @@
+package grpc_requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/donetkit/contrib-gin/grpc_middleware/util/metautils"
+	"github.com/donetkit/contrib-gin/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	var sent string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent = metautils.ExtractOutgoing(ctx).Get(defaultMetadataKey)
+		return nil
+	}
+	interceptor := UnaryClientInterceptor()
+
+	ctx := requestid.NewContext(context.Background(), "abc")
+	assert.NoError(t, interceptor(ctx, "/svc/Method", nil, nil, nil, invoker))
+	assert.Equal(t, "abc", sent)
+
+	ctx = metadata.AppendToOutgoingContext(ctx, defaultMetadataKey, "set-by-caller")
+	assert.NoError(t, interceptor(ctx, "/svc/Method", nil, nil, nil, invoker))
+	assert.Equal(t, "set-by-caller", sent)
+
+	assert.NoError(t, interceptor(context.Background(), "/svc/Method", nil, nil, nil, invoker))
+	assert.Empty(t, sent)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	var got string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = requestid.FromContext(ctx)
+		return nil, nil
+	}
+	interceptor := UnaryServerInterceptor(WithMetadataKey("X-Trace-Id"), WithGenerator(func() string { return "generated" }))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-trace-id", "abc"))
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", got)
+
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "generated", got)
+
+	for _, id := range []string{"abc\n[INFO] forged", strings.Repeat("a", 129)} {
+		ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-trace-id", id))
+		_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+		assert.NoError(t, err)
+		assert.Equal(t, "generated", got)
+	}
+}
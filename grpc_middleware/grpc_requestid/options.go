@@ -0,0 +1,72 @@
+package grpc_requestid
+
+import (
+	"strings"
+
+	"github.com/donetkit/contrib-gin/middleware/requestid"
+	"github.com/donetkit/contrib/utils/uuid"
+)
+
+const defaultMetadataKey = "x-request-id"
+
+var (
+	defaultOptions = &options{
+		metadataKey: defaultMetadataKey,
+		generator:   uuid.NewUUID,
+		maxLength:   requestid.DefaultMaxLength,
+	}
+)
+
+type options struct {
+	metadataKey string
+	generator   func() string
+	maxLength   int
+	validator   func(id string) bool
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// WithMetadataKey customizes the metadata key carrying the id, gRPC metadata keys are lower case.
+func WithMetadataKey(key string) Option {
+	return func(o *options) {
+		o.metadataKey = strings.ToLower(key)
+	}
+}
+
+// WithGenerator customizes the function generating an id for calls that arrive without one, nil leaves them without.
+func WithGenerator(f func() string) Option {
+	return func(o *options) {
+		o.generator = f
+	}
+}
+
+// WithMaxLength customizes the longest incoming id kept (default 128), longer ones are replaced by a generated id.
+func WithMaxLength(n int) Option {
+	return func(o *options) {
+		o.maxLength = n
+	}
+}
+
+// WithValidator replaces the check of incoming ids, which by default only accepts letters, digits and -_.:/+=@.
+func WithValidator(fn func(id string) bool) Option {
+	return func(o *options) {
+		o.validator = fn
+	}
+}
+
+// valid reports whether an incoming id may be kept
+func (o *options) valid(id string) bool {
+	if o.validator != nil {
+		return o.validator(id)
+	}
+	return requestid.ValidID(id, o.maxLength)
+}
@@ -0,0 +1,29 @@
+// Package ginctx copies a gin.Context for a handler run on another goroutine.
+package ginctx
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Copy returns c.Copy() which, unlike the gin copy, keeps the route template
+// of FullPath and is not aborted, so the caller can tell whether the handler
+// run on it aborted. Should the fields of gin.Context change, the copy is
+// aborted from the start as the gin one.
+func Copy(c *gin.Context) *gin.Context {
+	cp := c.Copy()
+	v := reflect.ValueOf(cp).Elem()
+	set(v, "fullPath", reflect.ValueOf(c.FullPath()))
+	set(v, "index", reflect.ValueOf(int8(-1)))
+	return cp
+}
+
+func set(v reflect.Value, name string, val reflect.Value) {
+	f := v.FieldByName(name)
+	if !f.IsValid() || f.Type() != val.Type() {
+		return
+	}
+	reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Set(val)
+}
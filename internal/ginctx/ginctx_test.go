@@ -0,0 +1,25 @@
+package ginctx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopy(t *testing.T) {
+	var cp *gin.Context
+	r := gin.New()
+	r.GET("/users/:id", func(c *gin.Context) {
+		cp = Copy(c)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	assert.Equal(t, "/users/:id", cp.FullPath())
+	assert.Equal(t, "1", cp.Param("id"))
+	assert.False(t, cp.IsAborted())
+	cp.Abort()
+	assert.True(t, cp.IsAborted())
+}
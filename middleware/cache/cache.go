@@ -2,13 +2,19 @@ package cache
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/donetkit/contrib-gin/internal/ginctx"
 	"github.com/donetkit/contrib/utils/cache"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,127 +25,328 @@ var (
 	ErrNotSupport   = errors.New("cache: not support.")
 )
 
+const (
+	varySuffix         = ":vary"
+	defaultMaxBodySize = 1 << 20
+
+	// revalidateTimeout bounds a background render, which outlives its request
+	revalidateTimeout = time.Minute
+)
+
+// notModifiedHeaders are replayed from the cached response on a 304
+var notModifiedHeaders = []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary"}
+
 type responseCache struct {
-	status int
-	header http.Header
-	data   []byte
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	Data         []byte      `json:"data"`
+	Created      time.Time   `json:"created"`
+	Expires      time.Time   `json:"expires"`
+	Revalidate   time.Time   `json:"revalidate"`
+	StaleIfError time.Time   `json:"stale_if_error"`
 }
 
-type cachedWriter struct {
-	c *gin.Context
-	gin.ResponseWriter
-	status  int
-	written bool
-	store   cache.ICache
-	expire  time.Duration
-	key     string
+type pageCache struct {
+	*option
+	flight *flight
+	// chained is set when next is the rest of the gin chain, which only runs
+	// on the request goroutine
+	chained bool
 }
 
-func SiteCache(store cache.ICache, expire time.Duration) gin.HandlerFunc {
+// SiteCache caches the responses of every route behind it. Stale pages are
+// revalidated on the request goroutine after the stale copy was sent, as the
+// routes behind it can't run once the request returned.
+func SiteCache(store cache.ICache, expire time.Duration, opts ...Option) gin.HandlerFunc {
+	p := newPageCache(store, expire, opts...)
+	p.chained = true
 	return func(c *gin.Context) {
-		url := c.Request.URL
-		key := urlEscape(PageCachePrefix, url.RequestURI())
-		var cacheData = store.WithDB(0).WithContext(c.Request.Context()).Get(key)
-		if cacheData == nil {
-			c.Next()
-			return
-		}
-		cache, ok := cacheData.(responseCache)
-		if !ok {
-			c.Next()
-		}
-		c.Writer.WriteHeader(cache.status)
-		for k, val := range cache.header {
-			for _, v := range val {
-				c.Writer.Header().Add(k, v)
-			}
-		}
-		c.Writer.Write(cache.data)
+		p.handle(c, (*gin.Context).Next)
 	}
 }
 
-func CachePage(store cache.ICache, expire time.Duration, handle gin.HandlerFunc) gin.HandlerFunc {
+// CachePage caches the responses of a single handler
+func CachePage(store cache.ICache, expire time.Duration, handle gin.HandlerFunc, opts ...Option) gin.HandlerFunc {
+	p := newPageCache(store, expire, opts...)
 	return func(c *gin.Context) {
-		url := c.Request.URL
-		key := urlEscape(PageCachePrefix, url.RequestURI())
-		cacheData := store.WithDB(0).WithContext(c.Request.Context()).Get(key)
-		if cacheData == nil { // replace writer
-			writer := newCachedWriter(c, store, expire, c.Writer, key)
-			c.Writer = writer
-			handle(c)
-		}
-		cache, ok := cacheData.(responseCache) // replace writer
-		if ok {
-			c.Writer.WriteHeader(cache.status)
-			for k, vals := range cache.header {
-				for _, v := range vals {
-					c.Writer.Header().Add(k, v)
-				}
-			}
-			c.Writer.Write(cache.data)
-		}
+		p.handle(c, handle)
 	}
 }
 
-func NewPageCache(store cache.ICache, expire time.Duration, handle gin.HandlerFunc) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		url := c.Request.URL
-		key := urlEscape(PageCachePrefix, url.RequestURI())
-		cacheData := store.WithDB(0).WithContext(c.Request.Context()).Get(key)
-		if cacheData == nil {
-			writer := newCachedWriter(c, store, expire, c.Writer, key) // replace writer
-			c.Writer = writer
-			handle(c)
-			return
+func NewPageCache(store cache.ICache, expire time.Duration, handle gin.HandlerFunc, opts ...Option) gin.HandlerFunc {
+	return CachePage(store, expire, handle, opts...)
+}
+
+func newPageCache(store cache.ICache, expire time.Duration, opts ...Option) *pageCache {
+	o := &option{
+		cache:           store,
+		expire:          expire,
+		singleFlight:    true,
+		cacheableStatus: map[int]bool{http.StatusOK: true},
+		maxBodySize:     defaultMaxBodySize,
+		keyFunc:         DefaultKey,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &pageCache{option: o, flight: newFlight()}
+}
+
+func (p *pageCache) handle(c *gin.Context, next gin.HandlerFunc) {
+	lookup, store := requestPolicy(c.Request)
+	if !lookup && !store {
+		next(c)
+		return
+	}
+	key := urlEscape(PageCachePrefix, p.keyFunc(c))
+	var stale *responseCache
+	if lookup {
+		if resp := p.load(c, key); resp != nil {
+			if time.Now().Before(resp.Expires) {
+				p.metrics.request(resultHit)
+				p.serve(c, resp)
+				c.Abort()
+				return
+			}
+			stale = resp
 		}
-		cache, ok := cacheData.(responseCache)
-		if ok {
-			c.Writer.WriteHeader(cache.status)
-			for k, vals := range cache.header {
-				for _, v := range vals {
-					c.Writer.Header().Add(k, v)
+	}
+	if stale != nil {
+		p.metrics.request(resultStale)
+	} else {
+		p.metrics.request(resultMiss)
+	}
+	if !store {
+		next(c)
+		return
+	}
+	if stale != nil && time.Now().Before(stale.Revalidate) {
+		p.revalidate(c, key, stale, next)
+		return
+	}
+	if p.singleFlight {
+		leader, wait := p.flight.join(key)
+		if leader {
+			defer p.flight.done(key)
+		} else {
+			select {
+			case <-wait:
+			case <-c.Request.Context().Done():
+			}
+			// a request asking for a fresh page renders its own
+			if lookup {
+				if resp := p.load(c, key); resp != nil && time.Now().Before(resp.Expires) {
+					p.serve(c, resp)
+					c.Abort()
+					return
 				}
 			}
-			c.Writer.Write(cache.data)
 		}
-
 	}
+	w := c.Writer
+	defer func() {
+		c.Writer = w
+	}()
+	cached := newCachedWriter(c, p, w, key) // replace writer
+	if stale == nil || !time.Now().Before(stale.StaleIfError) {
+		c.Writer = cached
+		next(c)
+		cached.commit()
+		return
+	}
+	// hold the response back so a failure can still be answered with the stale page
+	buffer := newBufferWriter(cached)
+	c.Writer = buffer
+	next(c)
+	c.Writer = w
+	if buffer.Status() >= http.StatusInternalServerError {
+		p.serve(c, stale)
+		return
+	}
+	if err := buffer.commit(); err != nil && p.logger != nil {
+		p.logger.Error(err)
+	}
+	cached.commit()
 }
 
-func newCachedWriter(c *gin.Context, store cache.ICache, expire time.Duration, writer gin.ResponseWriter, key string) *cachedWriter {
-	return &cachedWriter{c, writer, 0, false, store, expire, key}
+// background renders next into the cache on a copy of c, detached from the
+// request which has already been answered. The copy keeps the route template,
+// so the page is rendered and tagged as in the foreground. The caller leads
+// the flight of key.
+func (p *pageCache) background(c *gin.Context, key string, next gin.HandlerFunc) {
+	ctx, cancel := context.WithTimeout(detached{c.Request.Context()}, revalidateTimeout)
+	bg := ginctx.Copy(c)
+	bg.Request = c.Request.Clone(ctx)
+	cached := newCachedWriter(bg, p, newBufferWriter(bg.Writer), key)
+	bg.Writer = cached
+	go func() {
+		defer cancel()
+		defer p.flight.done(key)
+		defer func() {
+			if err := recover(); err != nil && p.logger != nil {
+				p.logger.Error(fmt.Sprintf("cache: revalidating %s: %v", key, err))
+			}
+		}()
+		next(bg)
+		cached.commit()
+	}()
 }
 
-func (w *cachedWriter) WriteHeader(code int) {
-	w.status = code
-	w.written = true
-	w.ResponseWriter.WriteHeader(code)
+// detached keeps the values of a request context but not its cancellation
+type detached struct {
+	context.Context
 }
 
-func (w *cachedWriter) Status() int {
-	return w.status
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// revalidate answers with the stale page, then renders a fresh copy into the
+// cache in the background unless another request is already doing so
+func (p *pageCache) revalidate(c *gin.Context, key string, stale *responseCache, next gin.HandlerFunc) {
+	if c.Request.Method != http.MethodHead {
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(stale.Data)))
+	}
+	p.serve(c, stale)
+	c.Writer.Flush()
+	leader, _ := p.flight.join(key)
+	if !leader {
+		c.Abort()
+		return
+	}
+	if !p.chained {
+		c.Abort()
+		p.background(c, key, next)
+		return
+	}
+	defer p.flight.done(key)
+	w := c.Writer
+	cached := newCachedWriter(c, p, newBufferWriter(w), key)
+	c.Writer = cached
+	defer func() {
+		c.Writer = w
+	}()
+	next(c)
+	cached.commit()
 }
 
-func (w *cachedWriter) Written() bool {
-	return w.written
+func (p *pageCache) store(c *gin.Context) cache.ICache {
+	return p.cache.WithDB(0).WithContext(c.Request.Context())
 }
 
-func (w *cachedWriter) Write(data []byte) (int, error) {
-	ret, err := w.ResponseWriter.Write(data)
-	if err == nil {
-		//cache response
-		store := w.store
-		val := responseCache{
-			w.status,
-			w.Header(),
-			data,
+// load returns the cached response of key, which may be expired but still
+// servable as a stale page
+func (p *pageCache) load(c *gin.Context, key string) *responseCache {
+	store := p.store(c)
+	if vary, ok := store.Get(key + varySuffix).(string); ok && vary != "" {
+		key = varyKey(key, strings.Split(vary, ","), c.Request.Header)
+	}
+	var resp responseCache
+	switch val := store.Get(key).(type) {
+	case *responseCache:
+		resp = *val
+	case string:
+		if err := json.Unmarshal([]byte(val), &resp); err != nil {
+			if p.logger != nil {
+				p.logger.Error(err)
+			}
+			return nil
 		}
-		err = store.WithDB(0).WithContext(w.c.Request.Context()).Set(w.key, val, w.expire)
-		if err != nil {
-			// need logger
+		if tiered, ok := store.(*TieredStore); ok {
+			// keep the decoded page in process so later hits skip unmarshalling
+			decoded := resp
+			tiered.local.replace(key, &decoded)
 		}
+	default:
+		return nil
+	}
+	now := time.Now()
+	if now.After(resp.Expires) && now.After(resp.Revalidate) && now.After(resp.StaleIfError) {
+		return nil
+	}
+	cc := parseCacheControl(c.Request.Header.Values("Cache-Control"))
+	if maxAge, ok := cc.seconds("max-age"); ok && now.Sub(resp.Created) > maxAge {
+		return nil
+	}
+	return &resp
+}
+
+func (p *pageCache) save(c *gin.Context, key string, status int, header http.Header, data []byte) error {
+	ttl, ok := responseTTL(c.Request, header, p.expire)
+	if !ok {
+		return nil
+	}
+	cc := parseCacheControl(header.Values("Cache-Control"))
+	revalidate, staleIfError := p.staleWhileRevalidate, p.staleIfError
+	if window, ok := cc.seconds("stale-while-revalidate"); ok {
+		revalidate = window
+	}
+	if window, ok := cc.seconds("stale-if-error"); ok {
+		staleIfError = window
+	}
+	keep := ttl + revalidate
+	if ttl+staleIfError > keep {
+		keep = ttl + staleIfError
+	}
+	store := p.store(c)
+	vary := varyHeaders(header)
+	if len(vary) > 0 {
+		if err := store.Set(key+varySuffix, strings.Join(vary, ","), keep); err != nil {
+			return err
+		}
+	} else {
+		store.Delete(key + varySuffix)
+	}
+	now := time.Now()
+	val, err := json.Marshal(responseCache{
+		Status:       status,
+		Header:       header.Clone(),
+		Data:         data,
+		Created:      now,
+		Expires:      now.Add(ttl),
+		Revalidate:   now.Add(ttl + revalidate),
+		StaleIfError: now.Add(ttl + staleIfError),
+	})
+	if err != nil {
+		return err
+	}
+	entry := varyKey(key, vary, c.Request.Header)
+	if err = store.Set(entry, string(val), keep); err != nil {
+		return err
+	}
+	p.metrics.stored()
+	for _, tag := range c.GetStringSlice(tagsContextKey) {
+		if err = addTag(c.Request.Context(), store, tag, entry, now.Add(keep)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pageCache) serve(c *gin.Context, resp *responseCache) {
+	header := c.Writer.Header()
+	age := strconv.Itoa(int(time.Since(resp.Created).Seconds()))
+	if resp.Status == http.StatusOK && notModified(c.Request, resp.Header) {
+		for _, name := range notModifiedHeaders {
+			if vals := resp.Header.Values(name); len(vals) > 0 {
+				header[http.CanonicalHeaderKey(name)] = append([]string(nil), vals...)
+			}
+		}
+		header.Set("Age", age)
+		c.Writer.WriteHeader(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	for k, vals := range resp.Header {
+		header[k] = append([]string(nil), vals...)
+	}
+	header.Set("Age", age)
+	c.Writer.WriteHeader(resp.Status)
+	if c.Request.Method == http.MethodHead {
+		c.Writer.WriteHeaderNow()
+		return
 	}
-	return ret, err
+	c.Writer.Write(resp.Data)
 }
 
 func urlEscape(prefix string, u string) string {
@@ -0,0 +1,473 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib/utils/cache"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryItem struct {
+	value   interface{}
+	expires time.Time
+}
+
+// memoryStore implements the parts of cache.ICache used by the page cache
+type memoryStore struct {
+	cache.ICache
+	mu     sync.Mutex
+	items  map[string]memoryItem
+	hashes map[string]map[string]interface{}
+	// dbs are the stores of every DB, shared by all of them
+	dbs map[int]*memoryStore
+}
+
+func newMemoryStore() *memoryStore {
+	s := &memoryStore{items: map[string]memoryItem{}, hashes: map[string]map[string]interface{}{}}
+	s.dbs = map[int]*memoryStore{0: s}
+	return s
+}
+
+func (s *memoryStore) WithDB(db int) cache.ICache {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dbs[db] == nil {
+		s.dbs[db] = &memoryStore{items: map[string]memoryItem{}, hashes: map[string]map[string]interface{}{}, dbs: s.dbs}
+	}
+	return s.dbs[db]
+}
+
+func (s *memoryStore) WithContext(context.Context) cache.ICache {
+	return s
+}
+
+func (s *memoryStore) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[key]
+	if !ok || time.Now().After(item.expires) {
+		return nil
+	}
+	return item.value
+}
+
+func (s *memoryStore) Set(key string, value interface{}, timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = memoryItem{value: value, expires: time.Now().Add(timeout)}
+	return nil
+}
+
+func (s *memoryStore) Delete(keys ...string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, key := range keys {
+		if _, ok := s.items[key]; ok {
+			delete(s.items, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (s *memoryStore) Scan(cursor uint64, match string, count int64) ([]string, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	prefix := strings.TrimSuffix(match, "*")
+	for key := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range s.hashes {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, 0
+}
+
+func (s *memoryStore) HashKeys(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var fields []string
+	for field := range s.hashes[key] {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func (s *memoryStore) HashDel(key string, fields ...string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, field := range fields {
+		if _, ok := s.hashes[key][field]; ok {
+			delete(s.hashes[key], field)
+			n++
+		}
+	}
+	if len(s.hashes[key]) == 0 {
+		delete(s.hashes, key)
+	}
+	return n
+}
+
+func (s *memoryStore) Pipeline() redis.Pipeliner {
+	return &memoryPipeline{store: s}
+}
+
+// memoryPipeline runs the tagScript of addTag on the hashes of the store
+type memoryPipeline struct {
+	redis.Pipeliner
+	store *memoryStore
+}
+
+func (p *memoryPipeline) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+	hash, ok := p.store.hashes[keys[0]]
+	if !ok {
+		hash = map[string]interface{}{}
+		p.store.hashes[keys[0]] = hash
+	}
+	hash[args[0].(string)] = args[1]
+	return redis.NewCmd(ctx)
+}
+
+func (p *memoryPipeline) Exec(context.Context) ([]redis.Cmder, error) {
+	return nil, nil
+}
+
+func performRequest(r http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func countingHandler(calls *int, setup func(c *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		*calls++
+		if setup != nil {
+			setup(c)
+		}
+		c.String(http.StatusOK, "hello %s", c.GetHeader("Accept-Language"))
+	}
+}
+
+func TestCachePage(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, nil)))
+
+	w1 := performRequest(r, http.MethodGet, "/", nil)
+	w2 := performRequest(r, http.MethodGet, "/", nil)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, w1.Body.String(), w2.Body.String())
+	assert.NotEmpty(t, w2.Header().Get("Age"))
+}
+
+func TestSiteCache(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.Use(SiteCache(newMemoryStore(), time.Minute))
+	r.GET("/", countingHandler(&calls, nil))
+
+	performRequest(r, http.MethodGet, "/", nil)
+	w := performRequest(r, http.MethodGet, "/", nil)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "hello ", w.Body.String())
+}
+
+func TestCachePageNoStore(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.GET("/request", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, nil)))
+	r.GET("/response", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, func(c *gin.Context) {
+		c.Header("Cache-Control", "private, max-age=60")
+	})))
+
+	noStore := http.Header{"Cache-Control": []string{"no-store"}}
+	performRequest(r, http.MethodGet, "/request", noStore)
+	performRequest(r, http.MethodGet, "/request", noStore)
+	performRequest(r, http.MethodGet, "/response", nil)
+	performRequest(r, http.MethodGet, "/response", nil)
+
+	assert.Equal(t, 4, calls)
+}
+
+func TestCachePageAuthorization(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, nil)))
+
+	auth := http.Header{"Authorization": []string{"Bearer token"}}
+	performRequest(r, http.MethodGet, "/", auth)
+	performRequest(r, http.MethodGet, "/", auth)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestCachePageVary(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, func(c *gin.Context) {
+		c.Header("Vary", "Accept-Language")
+	})))
+
+	en := http.Header{"Accept-Language": []string{"en"}}
+	de := http.Header{"Accept-Language": []string{"de"}}
+	performRequest(r, http.MethodGet, "/", en)
+	w1 := performRequest(r, http.MethodGet, "/", de)
+	w2 := performRequest(r, http.MethodGet, "/", en)
+	w3 := performRequest(r, http.MethodGet, "/", de)
+
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "hello de", w1.Body.String())
+	assert.Equal(t, "hello en", w2.Body.String())
+	assert.Equal(t, "hello de", w3.Body.String())
+}
+
+func TestCachePageConditional(t *testing.T) {
+	calls := 0
+	modified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, func(c *gin.Context) {
+		c.Header("ETag", `"v1"`)
+		c.Header("Last-Modified", modified)
+	})))
+
+	performRequest(r, http.MethodGet, "/", nil)
+	w1 := performRequest(r, http.MethodGet, "/", http.Header{"If-None-Match": []string{`W/"v1"`}})
+	w2 := performRequest(r, http.MethodGet, "/", http.Header{"If-Modified-Since": []string{modified}})
+	w3 := performRequest(r, http.MethodGet, "/", http.Header{"If-None-Match": []string{`"v2"`}})
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusNotModified, w1.Code)
+	assert.Empty(t, w1.Body.String())
+	assert.Equal(t, `"v1"`, w1.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, w2.Code)
+	assert.Equal(t, http.StatusOK, w3.Code)
+	assert.Equal(t, "hello ", w3.Body.String())
+}
+
+func TestCachePageMaxAge(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, func(c *gin.Context) {
+		c.Header("Cache-Control", "max-age=0")
+	})))
+
+	performRequest(r, http.MethodGet, "/", nil)
+	performRequest(r, http.MethodGet, "/", nil)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestCachePageSingleFlight(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), time.Minute, func(c *gin.Context) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		c.String(http.StatusOK, "hello")
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := performRequest(r, http.MethodGet, "/", nil)
+			assert.Equal(t, "hello", w.Body.String())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, calls)
+}
+
+func TestCachePageStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), 20*time.Millisecond, func(c *gin.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		if n > 1 {
+			<-release
+		}
+		c.String(http.StatusOK, "v%d", n)
+	}, WithStaleWhileRevalidate(time.Minute)))
+
+	performRequest(r, http.MethodGet, "/", nil)
+	time.Sleep(30 * time.Millisecond)
+	// the stale copy is answered while the refresh is still rendering
+	w1 := performRequest(r, http.MethodGet, "/", nil)
+	assert.Equal(t, "v1", w1.Body.String())
+	assert.Equal(t, "2", w1.Header().Get("Content-Length"))
+	assert.Equal(t, "v1", performRequest(r, http.MethodGet, "/", nil).Body.String())
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		return performRequest(r, http.MethodGet, "/", nil).Body.String() == "v2"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestStaleWhileRevalidateRoute(t *testing.T) {
+	routes := make(chan string, 2)
+	r := gin.New()
+	r.GET("/users/:id", CachePage(newMemoryStore(), 20*time.Millisecond, func(c *gin.Context) {
+		routes <- c.FullPath()
+		c.String(http.StatusOK, "%s %s", c.FullPath(), c.Param("id"))
+	}, WithStaleWhileRevalidate(time.Minute)))
+
+	performRequest(r, http.MethodGet, "/users/1", nil)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, "/users/:id 1", performRequest(r, http.MethodGet, "/users/1", nil).Body.String())
+
+	assert.Equal(t, "/users/:id", <-routes)
+	// the background render sees the same route template
+	assert.Equal(t, "/users/:id", <-routes)
+}
+
+func TestSingleFlightNoCache(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), time.Minute, func(c *gin.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 1 {
+			<-release
+		}
+		c.String(http.StatusOK, "v%d", n)
+	}))
+
+	leader := make(chan string)
+	go func() {
+		leader <- performRequest(r, http.MethodGet, "/", nil).Body.String()
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+	follower := make(chan string)
+	go func() {
+		follower <- performRequest(r, http.MethodGet, "/", http.Header{"Cache-Control": []string{"no-cache"}}).Body.String()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, "v1", <-leader)
+	// the follower asked for a fresh page, not the one of the leader
+	assert.Equal(t, "v2", <-follower)
+}
+
+func TestCachePageStaleIfError(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), 20*time.Millisecond, func(c *gin.Context) {
+		calls++
+		if calls > 1 {
+			c.String(http.StatusInternalServerError, "failed")
+			return
+		}
+		c.String(http.StatusOK, "hello")
+	}, WithStaleIfError(time.Minute)))
+
+	performRequest(r, http.MethodGet, "/", nil)
+	time.Sleep(30 * time.Millisecond)
+	w1 := performRequest(r, http.MethodGet, "/", nil)
+	w2 := performRequest(r, http.MethodGet, "/", nil)
+
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, http.StatusOK, w1.Code)
+	assert.Equal(t, "hello", w1.Body.String())
+	assert.Equal(t, "hello", w2.Body.String())
+}
+
+func TestCachePageMultipleWrites(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), time.Minute, func(c *gin.Context) {
+		calls++
+		c.Writer.WriteString("hello ")
+		c.Writer.Write([]byte("world"))
+	}))
+
+	performRequest(r, http.MethodGet, "/", nil)
+	w := performRequest(r, http.MethodGet, "/", nil)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "hello world", w.Body.String())
+}
+
+func TestCachePageNotCommitted(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	store := newMemoryStore()
+	r.GET("/error", CachePage(store, time.Minute, func(c *gin.Context) {
+		calls++
+		c.String(http.StatusInternalServerError, "failed")
+	}))
+	r.GET("/redirect", CachePage(store, time.Minute, func(c *gin.Context) {
+		calls++
+		c.Redirect(http.StatusFound, "/")
+	}))
+	r.GET("/cookie", CachePage(store, time.Minute, func(c *gin.Context) {
+		calls++
+		c.SetCookie("session", "secret", 60, "/", "", false, true)
+		c.String(http.StatusOK, "hello")
+	}))
+	r.GET("/large", CachePage(store, time.Minute, func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, "hello world")
+	}, WithMaxBodySize(5)))
+	r.GET("/stream", CachePage(store, time.Minute, func(c *gin.Context) {
+		calls++
+		c.Writer.WriteString("hello")
+		c.Writer.Flush()
+	}))
+
+	for _, path := range []string{"/error", "/redirect", "/cookie", "/large", "/stream"} {
+		performRequest(r, http.MethodGet, path, nil)
+		performRequest(r, http.MethodGet, path, nil)
+	}
+
+	assert.Equal(t, 10, calls)
+	assert.Empty(t, store.items)
+}
+
+func TestCachePageCacheableStatus(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.GET("/", CachePage(newMemoryStore(), time.Minute, func(c *gin.Context) {
+		calls++
+		c.String(http.StatusNotFound, "missing")
+	}, WithCacheableStatus(http.StatusOK, http.StatusNotFound)))
+
+	performRequest(r, http.MethodGet, "/", nil)
+	w := performRequest(r, http.MethodGet, "/", nil)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "missing", w.Body.String())
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds the directives of a Cache-Control header
+type cacheControl map[string]string
+
+func parseCacheControl(values []string) cacheControl {
+	cc := cacheControl{}
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, arg := part, ""
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				name = strings.TrimSpace(part[:i])
+				arg = strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			}
+			cc[strings.ToLower(name)] = arg
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns the delta-seconds argument of a directive
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 {
+		return 0, true
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// requestPolicy reports whether a request may be answered from the cache and
+// whether its response may be stored
+func requestPolicy(r *http.Request) (lookup bool, store bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false, false
+	}
+	cc := parseCacheControl(r.Header.Values("Cache-Control"))
+	if cc.has("no-store") {
+		return false, false
+	}
+	lookup = !cc.has("no-cache") && r.Header.Get("Pragma") != "no-cache"
+	if age, ok := cc.seconds("max-age"); ok && age == 0 {
+		lookup = false
+	}
+	return lookup, r.Method == http.MethodGet
+}
+
+// responseTTL returns how long a response may be kept by a shared cache
+func responseTTL(r *http.Request, header http.Header, expire time.Duration) (time.Duration, bool) {
+	cc := parseCacheControl(header.Values("Cache-Control"))
+	if cc.has("no-store") || cc.has("private") || cc.has("no-cache") {
+		return 0, false
+	}
+	vary := varyHeaders(header)
+	for _, name := range vary {
+		if name == "*" {
+			return 0, false
+		}
+	}
+	if r.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return 0, false
+	}
+	ttl := expire
+	if age, ok := cc.seconds("s-maxage"); ok {
+		ttl = age
+	} else if age, ok := cc.seconds("max-age"); ok {
+		ttl = age
+	}
+	return ttl, ttl > 0
+}
+
+// varyHeaders returns the canonical, sorted header names listed in Vary
+func varyHeaders(header http.Header) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			name = textproto.CanonicalMIMEHeaderKey(name)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// varyKey folds the request values of the vary headers into the cache key
+func varyKey(key string, vary []string, header http.Header) string {
+	if len(vary) == 0 {
+		return key
+	}
+	h := sha1.New()
+	for _, name := range vary {
+		io.WriteString(h, name)
+		h.Write([]byte{0})
+		io.WriteString(h, strings.Join(header.Values(name), ","))
+		h.Write([]byte{0})
+	}
+	return key + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since against a cached response
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := header.Get("ETag")
+		return etag != "" && etagMatch(inm, etag)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	lm := header.Get("Last-Modified")
+	if ims == "" || lm == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lm)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// etagMatch uses the weak comparison required for If-None-Match
+func etagMatch(list string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
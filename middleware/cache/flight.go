@@ -0,0 +1,35 @@
+package cache
+
+import "sync"
+
+// flight tracks the cache keys that are currently being rendered by a handler
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]chan struct{}
+}
+
+func newFlight() *flight {
+	return &flight{calls: map[string]chan struct{}{}}
+}
+
+// join reports whether the caller leads the render of key, otherwise it
+// returns a channel that is closed once the leader is done
+func (f *flight) join(key string) (bool, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if wait, ok := f.calls[key]; ok {
+		return false, wait
+	}
+	f.calls[key] = make(chan struct{})
+	return true, nil
+}
+
+// done releases the waiters of key, it must only be called by the leader
+func (f *flight) done(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if wait, ok := f.calls[key]; ok {
+		close(wait)
+		delete(f.calls, key)
+	}
+}
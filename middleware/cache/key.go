@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc returns the cache key of a request, before PageCachePrefix is applied
+type KeyFunc func(c *gin.Context) string
+
+// DefaultKey keys a page by its request uri
+func DefaultKey(c *gin.Context) string {
+	return c.Request.URL.RequestURI()
+}
+
+// KeyByHeader keys a page by its request uri and the values of the given headers
+func KeyByHeader(names ...string) KeyFunc {
+	return func(c *gin.Context) string {
+		var b strings.Builder
+		b.WriteString(c.Request.URL.RequestURI())
+		for _, name := range names {
+			b.WriteString("|")
+			b.WriteString(name)
+			b.WriteString("=")
+			b.WriteString(strings.Join(c.Request.Header.Values(name), ","))
+		}
+		return b.String()
+	}
+}
+
+// KeyByQuery keys a page by its path and the given query parameters only, so
+// tracking or cache busting parameters do not create new entries
+func KeyByQuery(params ...string) KeyFunc {
+	sorted := append([]string(nil), params...)
+	sort.Strings(sorted)
+	return func(c *gin.Context) string {
+		query := c.Request.URL.Query()
+		values := url.Values{}
+		for _, param := range sorted {
+			if vals, ok := query[param]; ok {
+				values[param] = vals
+			}
+		}
+		if len(values) == 0 {
+			return c.Request.URL.Path
+		}
+		return c.Request.URL.Path + "?" + values.Encode()
+	}
+}
+
+// KeyByUser keys a page by its request uri and the identity returned by user
+func KeyByUser(user func(c *gin.Context) string) KeyFunc {
+	return func(c *gin.Context) string {
+		return c.Request.URL.RequestURI() + "|user=" + user(c)
+	}
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	size    int
+	expires time.Time
+}
+
+// lru is a bounded in-process cache, evicting the least recently used
+// entries once the stored bytes exceed maxBytes
+type lru struct {
+	mu       sync.Mutex
+	maxBytes int
+	ttl      time.Duration
+	size     int
+	ll       *list.List
+	items    map[string]*list.Element
+	metrics  *Metrics
+}
+
+func newLRU(maxBytes int, ttl time.Duration, metrics *Metrics) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    map[string]*list.Element{},
+		metrics:  metrics,
+	}
+}
+
+func (l *lru) get(key string) (interface{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		l.remove(el, evictExpired)
+		return nil, false
+	}
+	l.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+// set stores value for at most the smaller of ttl and the local ttl
+func (l *lru) set(key string, value interface{}, size int, ttl time.Duration) {
+	size += len(key)
+	if size > l.maxBytes {
+		return
+	}
+	if ttl <= 0 || ttl > l.ttl {
+		ttl = l.ttl
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		l.remove(el, "")
+	}
+	l.items[key] = l.ll.PushFront(&lruEntry{key: key, value: value, size: size, expires: time.Now().Add(ttl)})
+	l.size += size
+	for l.size > l.maxBytes {
+		l.remove(l.ll.Back(), evictCapacity)
+	}
+}
+
+// replace swaps the value of key without changing its size or expiry
+func (l *lru) replace(key string, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		el.Value.(*lruEntry).value = value
+	}
+}
+
+func (l *lru) delete(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := l.items[key]; ok {
+			l.remove(el, evictPurge)
+		}
+	}
+}
+
+func (l *lru) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ll.Init()
+	l.items = map[string]*list.Element{}
+	l.size = 0
+}
+
+func (l *lru) stats() (entries int, size int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len(), l.size
+}
+
+// remove must be called with mu held, an empty reason is not recorded
+func (l *lru) remove(el *list.Element, reason string) {
+	entry := el.Value.(*lruEntry)
+	l.ll.Remove(el)
+	delete(l.items, entry.key)
+	l.size -= entry.size
+	if reason != "" {
+		l.metrics.evicted(tierLocal, reason)
+	}
+}
@@ -0,0 +1,108 @@
+package cache
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const (
+	tierLocal  = "local"
+	tierShared = "shared"
+
+	resultHit   = "hit"
+	resultMiss  = "miss"
+	resultStale = "stale"
+
+	evictCapacity = "capacity"
+	evictExpired  = "expired"
+	evictPurge    = "purge"
+)
+
+// Metrics counts page cache hits, misses, stores and evictions. It is a
+// prometheus.Collector, register it through prom.WithCollectors.
+type Metrics struct {
+	requests  *prometheus.CounterVec
+	lookups   *prometheus.CounterVec
+	stores    prometheus.Counter
+	evictions *prometheus.CounterVec
+}
+
+// NewMetrics creates the page cache collectors under namespace
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "page_cache_requests_total",
+				Help:      "Page cache requests by result (hit, stale, miss).",
+			}, []string{"result"},
+		),
+		lookups: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "page_cache_lookups_total",
+				Help:      "Page cache store lookups by tier and result.",
+			}, []string{"tier", "result"},
+		),
+		stores: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "page_cache_stores_total",
+				Help:      "Pages written to the cache.",
+			},
+		),
+		evictions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "page_cache_evictions_total",
+				Help:      "Page cache entries removed by tier and reason.",
+			}, []string{"tier", "reason"},
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.lookups.Describe(ch)
+	m.stores.Describe(ch)
+	m.evictions.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.lookups.Collect(ch)
+	m.stores.Collect(ch)
+	m.evictions.Collect(ch)
+}
+
+func (m *Metrics) request(result string) {
+	if m != nil {
+		m.requests.WithLabelValues(result).Inc()
+	}
+}
+
+func (m *Metrics) lookup(tier string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := resultMiss
+	if hit {
+		result = resultHit
+	}
+	m.lookups.WithLabelValues(tier, result).Inc()
+}
+
+func (m *Metrics) stored() {
+	if m != nil {
+		m.stores.Inc()
+	}
+}
+
+func (m *Metrics) evicted(tier string, reason string) {
+	m.evictedN(tier, reason, 1)
+}
+
+func (m *Metrics) evictedN(tier string, reason string, n int64) {
+	if m != nil && n > 0 {
+		m.evictions.WithLabelValues(tier, reason).Add(float64(n))
+	}
+}
@@ -3,11 +3,22 @@ package cache
 import (
 	"github.com/donetkit/contrib-log/glog"
 	"github.com/donetkit/contrib/utils/cache"
+	"time"
 )
 
 type option struct {
-	cache  cache.ICache
-	logger glog.ILoggerEntry
+	cache                cache.ICache
+	logger               glog.ILoggerEntry
+	expire               time.Duration
+	singleFlight         bool
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	cacheableStatus      map[int]bool
+	maxBodySize          int
+	keyFunc              KeyFunc
+	localSize            int
+	localTTL             time.Duration
+	metrics              *Metrics
 }
 
 type Option func(*option)
@@ -24,3 +35,76 @@ func WithCache(cache cache.ICache) Option {
 		o.cache = cache
 	}
 }
+
+// WithExpire default ttl when the response carries no max-age or s-maxage
+func WithExpire(expire time.Duration) Option {
+	return func(o *option) {
+		o.expire = expire
+	}
+}
+
+// WithSingleFlight coalesces concurrent misses of the same key into one handler call, default true
+func WithSingleFlight(enable bool) Option {
+	return func(o *option) {
+		o.singleFlight = enable
+	}
+}
+
+// WithStaleWhileRevalidate serve an expired page for up to window while one request refreshes it
+func WithStaleWhileRevalidate(window time.Duration) Option {
+	return func(o *option) {
+		o.staleWhileRevalidate = window
+	}
+}
+
+// WithStaleIfError serve an expired page for up to window when the handler fails with a 5xx
+func WithStaleIfError(window time.Duration) Option {
+	return func(o *option) {
+		o.staleIfError = window
+	}
+}
+
+// WithCacheableStatus status codes whose responses are stored, default 200
+func WithCacheableStatus(codes ...int) Option {
+	return func(o *option) {
+		o.cacheableStatus = map[int]bool{}
+		for _, code := range codes {
+			o.cacheableStatus[code] = true
+		}
+	}
+}
+
+// WithMaxBodySize responses with a larger body are not stored, default 1MB
+func WithMaxBodySize(size int) Option {
+	return func(o *option) {
+		o.maxBodySize = size
+	}
+}
+
+// WithKeyFunc derives the cache key of a request, default the request uri
+func WithKeyFunc(fn KeyFunc) Option {
+	return func(o *option) {
+		o.keyFunc = fn
+	}
+}
+
+// WithLocalSize byte limit of the local tier of NewTieredStore, default 64MB
+func WithLocalSize(size int) Option {
+	return func(o *option) {
+		o.localSize = size
+	}
+}
+
+// WithLocalTTL how long NewTieredStore keeps a page in process, default 10s
+func WithLocalTTL(ttl time.Duration) Option {
+	return func(o *option) {
+		o.localTTL = ttl
+	}
+}
+
+// WithMetrics record hits, misses, stores and evictions in metrics
+func WithMetrics(metrics *Metrics) Option {
+	return func(o *option) {
+		o.metrics = metrics
+	}
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/donetkit/contrib/utils/cache"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultAdminPrefix url prefix of the purge routes
+	DefaultAdminPrefix = "/cache"
+
+	tagsContextKey = "gincontrib.page.cache.tags"
+	scanCount      = 100
+)
+
+// tagScript adds an entry to the hash of a tag and extends, never shortens,
+// its TTL, so the index lives as long as its longest entry
+const tagScript = `
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+if redis.call('TTL', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('EXPIRE', KEYS[1], ARGV[3])
+end
+return 1`
+
+// Tag attaches invalidation tags to the page rendered by the current request
+func Tag(c *gin.Context, tags ...string) {
+	c.Set(tagsContextKey, append(c.GetStringSlice(tagsContextKey), tags...))
+}
+
+// Purge removes the page stored under key, including all of its Vary variants
+func Purge(store cache.ICache, key string) int64 {
+	store = store.WithDB(0)
+	entry := urlEscape(PageCachePrefix, key)
+	store.Delete(entry + varySuffix)
+	keys := append([]string{entry}, scanKeys(store, entry+":*")...)
+	return store.Delete(keys...)
+}
+
+// PurgeTag removes every page that was stored with tag. Only the entries
+// read are removed from the index, pages tagged meanwhile keep their tag.
+func PurgeTag(store cache.ICache, tag string) int64 {
+	store = store.WithDB(0)
+	index := tagKey(tag)
+	keys := store.HashKeys(index)
+	if len(keys) == 0 {
+		return 0
+	}
+	store.HashDel(index, keys...)
+	return store.Delete(keys...)
+}
+
+// PurgePrefix removes every page whose key starts with prefix. Keys longer
+// than 200 escaped bytes are stored hashed and can only be purged by Purge or PurgeTag.
+func PurgePrefix(store cache.ICache, prefix string) int64 {
+	store = store.WithDB(0)
+	var pages, vary []string
+	tags := tagPrefix()
+	for _, key := range scanKeys(store, PageCachePrefix+":"+url.QueryEscape(prefix)+"*") {
+		if strings.HasPrefix(key, tags) {
+			// tag indexes are not pages
+			continue
+		}
+		if strings.HasSuffix(key, varySuffix) {
+			vary = append(vary, key)
+		} else {
+			pages = append(pages, key)
+		}
+	}
+	if len(vary) > 0 {
+		store.Delete(vary...)
+	}
+	if len(pages) == 0 {
+		return 0
+	}
+	return store.Delete(pages...)
+}
+
+// RouteRegister exposes Purge, PurgeTag and PurgePrefix on the provided
+// gin.RouterGroup. prefixOptions is a optional, the first one replaces DefaultAdminPrefix.
+func RouteRegister(rg *gin.RouterGroup, store cache.ICache, prefixOptions ...string) {
+	prefix := DefaultAdminPrefix
+	if len(prefixOptions) > 0 {
+		prefix = prefixOptions[0]
+	}
+	prefixRouter := rg.Group(prefix)
+	{
+		prefixRouter.DELETE("/key", func(c *gin.Context) {
+			purged(c, c.Query("key"), Purge, store)
+		})
+		prefixRouter.DELETE("/tag/:tag", func(c *gin.Context) {
+			purged(c, c.Param("tag"), PurgeTag, store)
+		})
+		prefixRouter.DELETE("/prefix", func(c *gin.Context) {
+			purged(c, c.Query("prefix"), PurgePrefix, store)
+		})
+	}
+}
+
+func purged(c *gin.Context, arg string, purge func(cache.ICache, string) int64, store cache.ICache) {
+	if arg == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing purge argument"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": purge(store, arg)})
+}
+
+// tagPrefix starts the keys of the tag indexes, page keys are escaped and
+// never contain a raw colon
+func tagPrefix() string {
+	return PageCachePrefix + ":tag:"
+}
+
+func tagKey(tag string) string {
+	return tagPrefix() + url.QueryEscape(tag)
+}
+
+// addTag records entry in the hash of tag on the cache server, so replicas
+// tagging at the same time don't overwrite each other
+func addTag(ctx context.Context, store cache.ICache, tag string, entry string, expires time.Time) error {
+	ttl := int64(time.Until(expires)/time.Second) + 1
+	pipe := store.Pipeline()
+	pipe.Eval(ctx, tagScript, []string{tagKey(tag)}, entry, expires.Unix(), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func scanKeys(store cache.ICache, match string) []string {
+	var keys []string
+	var cursor uint64
+	for {
+		batch, next := store.Scan(cursor, match, scanCount)
+		keys = append(keys, batch...)
+		if next == 0 {
+			return keys
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurge(t *testing.T) {
+	calls := 0
+	store := newMemoryStore()
+	r := gin.New()
+	r.GET("/users/:id", CachePage(store, time.Minute, countingHandler(&calls, func(c *gin.Context) {
+		c.Header("Vary", "Accept-Language")
+	})))
+
+	performRequest(r, http.MethodGet, "/users/1", http.Header{"Accept-Language": []string{"en"}})
+	performRequest(r, http.MethodGet, "/users/1", http.Header{"Accept-Language": []string{"de"}})
+	performRequest(r, http.MethodGet, "/users/2", nil)
+
+	assert.Equal(t, int64(2), Purge(store, "/users/1"))
+	performRequest(r, http.MethodGet, "/users/1", http.Header{"Accept-Language": []string{"en"}})
+	performRequest(r, http.MethodGet, "/users/2", nil)
+	assert.Equal(t, 4, calls)
+
+	assert.Equal(t, int64(2), PurgePrefix(store, "/users/"))
+	performRequest(r, http.MethodGet, "/users/2", nil)
+	assert.Equal(t, 5, calls)
+}
+
+func TestPurgeOtherDB(t *testing.T) {
+	calls := 0
+	store := newMemoryStore()
+	r := gin.New()
+	r.GET("/users/:id", CachePage(store, time.Minute, countingHandler(&calls, func(c *gin.Context) {
+		Tag(c, "users")
+	})))
+	other := store.WithDB(3)
+
+	performRequest(r, http.MethodGet, "/users/1", nil)
+	assert.Equal(t, int64(1), Purge(other, "/users/1"))
+	performRequest(r, http.MethodGet, "/users/2", nil)
+	assert.Equal(t, int64(1), PurgePrefix(other, "/users/"))
+	performRequest(r, http.MethodGet, "/users/3", nil)
+	assert.Equal(t, int64(1), PurgeTag(other, "users"))
+}
+
+func TestPurgeTag(t *testing.T) {
+	calls := 0
+	store := newMemoryStore()
+	r := gin.New()
+	r.GET("/users/:id", CachePage(store, time.Minute, countingHandler(&calls, func(c *gin.Context) {
+		Tag(c, "user:"+c.Param("id"), "users")
+	})))
+
+	performRequest(r, http.MethodGet, "/users/1", nil)
+	performRequest(r, http.MethodGet, "/users/2", nil)
+
+	assert.Equal(t, int64(1), PurgeTag(store, "user:1"))
+	performRequest(r, http.MethodGet, "/users/1", nil)
+	performRequest(r, http.MethodGet, "/users/2", nil)
+	assert.Equal(t, 3, calls)
+
+	assert.Equal(t, int64(2), PurgeTag(store, "users"))
+	assert.Equal(t, int64(0), PurgeTag(store, "users"))
+
+	// purging by prefix leaves the tag indexes alone
+	performRequest(r, http.MethodGet, "/users/1", nil)
+	assert.Equal(t, int64(1), PurgePrefix(store, ""))
+	assert.Len(t, store.HashKeys(tagKey("user:1")), 1)
+	performRequest(r, http.MethodGet, "/users/1", nil)
+	assert.Equal(t, int64(1), PurgeTag(store, "user:1"))
+}
+
+func TestKeyFunc(t *testing.T) {
+	calls := 0
+	r := gin.New()
+	r.GET("/query", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, nil), WithKeyFunc(KeyByQuery("page"))))
+	r.GET("/header", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, nil), WithKeyFunc(KeyByHeader("X-Tenant"))))
+	r.GET("/user", CachePage(newMemoryStore(), time.Minute, countingHandler(&calls, nil), WithKeyFunc(KeyByUser(func(c *gin.Context) string {
+		return c.Query("user")
+	}))))
+
+	performRequest(r, http.MethodGet, "/query?page=1&utm=a", nil)
+	performRequest(r, http.MethodGet, "/query?utm=b&page=1", nil)
+	assert.Equal(t, 1, calls)
+
+	performRequest(r, http.MethodGet, "/header", http.Header{"X-Tenant": []string{"a"}})
+	performRequest(r, http.MethodGet, "/header", http.Header{"X-Tenant": []string{"b"}})
+	performRequest(r, http.MethodGet, "/header", http.Header{"X-Tenant": []string{"a"}})
+	assert.Equal(t, 3, calls)
+
+	performRequest(r, http.MethodGet, "/user?user=a", nil)
+	performRequest(r, http.MethodGet, "/user?user=a", nil)
+	assert.Equal(t, 4, calls)
+}
+
+func TestRouteRegister(t *testing.T) {
+	calls := 0
+	store := newMemoryStore()
+	r := gin.New()
+	RouteRegister(&r.RouterGroup, store)
+	r.GET("/users/:id", CachePage(store, time.Minute, countingHandler(&calls, func(c *gin.Context) {
+		Tag(c, "users")
+	})))
+
+	performRequest(r, http.MethodGet, "/users/1", nil)
+	w := performRequest(r, http.MethodDelete, "/cache/key?key=/users/1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"purged":1}`, w.Body.String())
+
+	performRequest(r, http.MethodGet, "/users/1", nil)
+	w = performRequest(r, http.MethodDelete, "/cache/tag/users", nil)
+	assert.JSONEq(t, `{"purged":1}`, w.Body.String())
+
+	w = performRequest(r, http.MethodDelete, "/cache/prefix", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/donetkit/contrib/utils/cache"
+)
+
+const (
+	defaultLocalSize = 64 << 20
+	defaultLocalTTL  = 10 * time.Second
+)
+
+// TieredStore puts a bounded in-process LRU in front of a shared cache.ICache.
+// Deletes and Flush fan out to both tiers, so pass the same TieredStore to the
+// middleware and to Purge, PurgeTag and PurgePrefix. Other replicas keep their
+// local copy until the local ttl expires.
+type TieredStore struct {
+	cache.ICache
+	local  *lru
+	stats  *tierStats
+	metric *Metrics
+}
+
+// TierStats are the counters of the local tier
+type TierStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+	Bytes   int
+}
+
+type tierStats struct {
+	hits   uint64
+	misses uint64
+}
+
+// NewTieredStore wraps store with a local tier, configured by WithLocalSize,
+// WithLocalTTL and WithMetrics
+func NewTieredStore(store cache.ICache, opts ...Option) *TieredStore {
+	o := &option{
+		localSize: defaultLocalSize,
+		localTTL:  defaultLocalTTL,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &TieredStore{
+		ICache: store,
+		local:  newLRU(o.localSize, o.localTTL, o.metrics),
+		stats:  &tierStats{},
+		metric: o.metrics,
+	}
+}
+
+func (s *TieredStore) WithDB(db int) cache.ICache {
+	return s.with(s.ICache.WithDB(db))
+}
+
+func (s *TieredStore) WithContext(ctx context.Context) cache.ICache {
+	return s.with(s.ICache.WithContext(ctx))
+}
+
+func (s *TieredStore) with(store cache.ICache) *TieredStore {
+	return &TieredStore{ICache: store, local: s.local, stats: s.stats, metric: s.metric}
+}
+
+func (s *TieredStore) Get(key string) interface{} {
+	if !localKey(key) {
+		return s.ICache.Get(key)
+	}
+	if val, ok := s.local.get(key); ok {
+		atomic.AddUint64(&s.stats.hits, 1)
+		s.metric.lookup(tierLocal, true)
+		return val
+	}
+	atomic.AddUint64(&s.stats.misses, 1)
+	s.metric.lookup(tierLocal, false)
+	val := s.ICache.Get(key)
+	s.metric.lookup(tierShared, val != nil)
+	if data, ok := val.(string); ok {
+		s.local.set(key, data, len(data), 0)
+	}
+	return val
+}
+
+func (s *TieredStore) Set(key string, val interface{}, timeout time.Duration) error {
+	if err := s.ICache.Set(key, val, timeout); err != nil {
+		return err
+	}
+	if data, ok := val.(string); ok && localKey(key) {
+		s.local.set(key, data, len(data), timeout)
+	}
+	return nil
+}
+
+func (s *TieredStore) Delete(keys ...string) int64 {
+	s.local.delete(keys...)
+	n := s.ICache.Delete(keys...)
+	s.metric.evictedN(tierShared, evictPurge, n)
+	return n
+}
+
+func (s *TieredStore) Flush() {
+	s.local.flush()
+	s.ICache.Flush()
+}
+
+// Stats returns the counters of the local tier
+func (s *TieredStore) Stats() TierStats {
+	entries, size := s.local.stats()
+	return TierStats{
+		Hits:    atomic.LoadUint64(&s.stats.hits),
+		Misses:  atomic.LoadUint64(&s.stats.misses),
+		Entries: entries,
+		Bytes:   size,
+	}
+}
+
+// localKey keeps tag indexes out of the local tier, they are read-modify-written
+func localKey(key string) bool {
+	return !strings.HasPrefix(key, PageCachePrefix+":tag:")
+}
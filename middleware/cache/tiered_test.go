@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTieredStore(t *testing.T) {
+	shared := newMemoryStore()
+	store := NewTieredStore(shared, WithLocalTTL(time.Minute))
+
+	assert.NoError(t, store.Set("a", "1", time.Minute))
+	assert.Equal(t, "1", store.Get("a"))
+	shared.Delete("a")
+	assert.Equal(t, "1", store.Get("a"))
+
+	assert.Nil(t, store.Get("b"))
+	shared.Set("b", "2", time.Minute)
+	assert.Equal(t, "2", store.Get("b"))
+
+	store.Delete("a", "b")
+	assert.Nil(t, store.Get("a"))
+	assert.Nil(t, store.Get("b"))
+
+	stats := store.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(4), stats.Misses)
+	assert.Equal(t, 0, stats.Entries)
+}
+
+func TestTieredStoreEviction(t *testing.T) {
+	metrics := NewMetrics("test")
+	store := NewTieredStore(newMemoryStore(), WithLocalSize(10), WithLocalTTL(20*time.Millisecond), WithMetrics(metrics))
+
+	store.Set("a", "1234", time.Minute)
+	store.Set("b", "1234", time.Minute)
+	store.Set("c", "1234", time.Minute)
+	assert.Equal(t, 10, store.Stats().Bytes)
+	assert.Equal(t, 2, store.Stats().Entries)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.evictions.WithLabelValues(tierLocal, evictCapacity)))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, "1234", store.Get("c"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.evictions.WithLabelValues(tierLocal, evictExpired)))
+}
+
+func TestTieredStorePageCache(t *testing.T) {
+	calls := 0
+	metrics := NewMetrics("test")
+	store := NewTieredStore(newMemoryStore(), WithMetrics(metrics))
+	r := gin.New()
+	r.GET("/", CachePage(store, time.Minute, countingHandler(&calls, nil), WithMetrics(metrics)))
+
+	performRequest(r, http.MethodGet, "/", nil)
+	performRequest(r, http.MethodGet, "/", nil)
+	w := performRequest(r, http.MethodGet, "/", nil)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "hello ", w.Body.String())
+
+	assert.Equal(t, int64(1), Purge(store, "/"))
+	performRequest(r, http.MethodGet, "/", nil)
+	assert.Equal(t, 2, calls)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.requests.WithLabelValues(resultHit)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.requests.WithLabelValues(resultMiss)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.stores))
+}
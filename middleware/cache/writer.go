@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cachedWriter passes the response through while collecting a copy of the
+// body, which is stored once the handler has finished
+type cachedWriter struct {
+	c *gin.Context
+	gin.ResponseWriter
+	cache     *pageCache
+	key       string
+	body      bytes.Buffer
+	streaming bool
+	oversize  bool
+}
+
+func newCachedWriter(c *gin.Context, cache *pageCache, writer gin.ResponseWriter, key string) *cachedWriter {
+	return &cachedWriter{c: c, ResponseWriter: writer, cache: cache, key: key}
+}
+
+func (w *cachedWriter) Write(data []byte) (int, error) {
+	ret, err := w.ResponseWriter.Write(data)
+	if err == nil && !w.streaming && !w.oversize {
+		if w.body.Len()+len(data) > w.cache.maxBodySize {
+			w.oversize = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(data)
+		}
+	}
+	return ret, err
+}
+
+func (w *cachedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush marks the response as streamed, which is never cached
+func (w *cachedWriter) Flush() {
+	w.streaming = true
+	w.body = bytes.Buffer{}
+	w.ResponseWriter.Flush()
+}
+
+// commit stores the collected response if it is cacheable
+func (w *cachedWriter) commit() {
+	if w.streaming || w.oversize || !w.cache.cacheableStatus[w.Status()] {
+		return
+	}
+	if w.Header().Get("Set-Cookie") != "" {
+		return
+	}
+	if err := w.cache.save(w.c, w.key, w.Status(), w.Header(), w.body.Bytes()); err != nil && w.cache.logger != nil {
+		w.cache.logger.Error(err)
+	}
+}
+
+// bufferWriter holds back the status, headers and body of a response until
+// commit is called, so the response can still be replaced
+type bufferWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferWriter(writer gin.ResponseWriter) *bufferWriter {
+	return &bufferWriter{ResponseWriter: writer, header: http.Header{}, status: http.StatusOK}
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) WriteHeaderNow() {}
+
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *bufferWriter) Flush() {}
+
+// commit writes the buffered response to the underlying writer
+func (w *bufferWriter) commit() error {
+	dst := w.ResponseWriter.Header()
+	for k, vals := range w.header {
+		dst[k] = vals
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	return err
+}
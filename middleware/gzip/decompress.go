@@ -0,0 +1,270 @@
+package gzip
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultMaxInflatedSize = 10 << 20
+	defaultMaxRatio        = 100
+	// small bodies legitimately inflate far beyond any sane ratio
+	minRatioSize = 64 << 10
+)
+
+var (
+	// ErrInflatedTooLarge is returned when a request body inflates past the size limit
+	ErrInflatedTooLarge = errors.New("decompressed request body too large")
+	// ErrRatioTooLarge is returned when a request body inflates past the ratio limit
+	ErrRatioTooLarge = errors.New("request body compression ratio too large")
+)
+
+type newReader func(r io.Reader, maxSize int64) (io.ReadCloser, error)
+
+var decoders = map[string]newReader{
+	"gzip": func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"x-gzip": func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": newDeflateReader,
+	"br": func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+	"zstd": func(r io.Reader, maxSize int64) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxSize)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+// DecompressOption for NewDecompressHandle
+type DecompressOption func(*decompressor)
+
+type decompressor struct {
+	maxSize   int64
+	maxRatio  float64
+	encodings map[string]newReader
+}
+
+// WithMaxInflatedSize set the bytes a request body may inflate to (default 10MB)
+func WithMaxInflatedSize(size int64) DecompressOption {
+	return func(d *decompressor) {
+		d.maxSize = size
+	}
+}
+
+// WithMaxRatio set how many times larger than the compressed body the
+// inflated body may grow once past 64KB (default 100), 0 disables the check
+func WithMaxRatio(ratio float64) DecompressOption {
+	return func(d *decompressor) {
+		d.maxRatio = ratio
+	}
+}
+
+// WithEncodings restrict the accepted request encodings, out of gzip,
+// deflate, br and zstd (default all of them)
+func WithEncodings(encodings ...string) DecompressOption {
+	return func(d *decompressor) {
+		d.encodings = map[string]newReader{}
+		for _, encoding := range encodings {
+			encoding = strings.ToLower(encoding)
+			if fn, ok := decoders[encoding]; ok {
+				d.encodings[encoding] = fn
+			}
+		}
+	}
+}
+
+// NewDecompressHandle returns a DecompressFn that inflates gzip, deflate, br
+// and zstd request bodies with a ceiling on the inflated size and on the
+// compression ratio. Bodies over either limit fail with 413 while the handler
+// reads them, unknown encodings are refused with 415 up front.
+func NewDecompressHandle(opts ...DecompressOption) func(c *gin.Context) {
+	d := &decompressor{
+		maxSize:   defaultMaxInflatedSize,
+		maxRatio:  defaultMaxRatio,
+		encodings: decoders,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d.handle
+}
+
+func (d *decompressor) handle(c *gin.Context) {
+	encodings := contentEncodings(c.Request.Header.Get("Content-Encoding"))
+	if len(encodings) == 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return
+	}
+
+	compressed := &countingReader{rdr: c.Request.Body}
+	var body io.ReadCloser = compressed
+	var chain []io.ReadCloser
+	// encodings are listed in the order they were applied
+	for i := len(encodings) - 1; i >= 0; i-- {
+		fn, ok := d.encodings[encodings[i]]
+		if !ok {
+			_ = closeAll(chain)
+			d.unsupported(c, encodings[i])
+			return
+		}
+		r, err := fn(body, d.maxSize)
+		if err != nil {
+			_ = closeAll(chain)
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		chain = append(chain, r)
+		body = r
+	}
+
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.Header.Del("Content-Length")
+	c.Request.ContentLength = -1
+	c.Request.Body = &inflatedReader{
+		ctx:        c,
+		rdr:        body,
+		decoders:   chain,
+		orig:       c.Request.Body,
+		compressed: compressed,
+		maxSize:    d.maxSize,
+		maxRatio:   d.maxRatio,
+	}
+}
+
+func (d *decompressor) unsupported(c *gin.Context, encoding string) {
+	supported := make([]string, 0, len(d.encodings))
+	for name := range d.encodings {
+		supported = append(supported, name)
+	}
+	err := fmt.Errorf("unsupported content encoding %q", encoding)
+	_ = c.Error(err)
+	c.Header("Accept-Encoding", strings.Join(supported, ", "))
+	c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+		"error":    "unsupported content encoding",
+		"encoding": encoding,
+	})
+}
+
+// contentEncodings splits a Content-Encoding header, dropping identity
+func contentEncodings(header string) []string {
+	var encodings []string
+	for _, encoding := range strings.Split(header, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" && encoding != "identity" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings
+}
+
+// newDeflateReader accepts zlib wrapped deflate as the RFC says, and the raw
+// deflate some clients send instead
+func newDeflateReader(r io.Reader, _ int64) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+type countingReader struct {
+	rdr io.ReadCloser
+	n   int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.rdr.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	return r.rdr.Close()
+}
+
+type inflatedReader struct {
+	ctx        *gin.Context
+	rdr        io.ReadCloser
+	decoders   []io.ReadCloser
+	orig       io.ReadCloser
+	compressed *countingReader
+	inflated   int64
+	maxSize    int64
+	maxRatio   float64
+	err        error
+}
+
+func (r *inflatedReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	// read one byte past the limit to tell an exact fit from an overflow
+	if remaining := r.maxSize - r.inflated + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.rdr.Read(p)
+	r.inflated += int64(n)
+	switch {
+	case r.inflated > r.maxSize, errors.Is(err, zstd.ErrDecoderSizeExceeded):
+		return 0, r.tooLarge(ErrInflatedTooLarge, r.maxSize)
+	case r.maxRatio > 0 && r.inflated > minRatioSize &&
+		float64(r.inflated) > float64(r.compressed.n)*r.maxRatio:
+		return 0, r.tooLarge(ErrRatioTooLarge, int64(r.maxRatio))
+	}
+	return n, err
+}
+
+func (r *inflatedReader) tooLarge(err error, limit int64) error {
+	r.err = err
+	c := r.ctx
+	_ = c.Error(err)
+	c.Header("connection", "close")
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": err.Error(),
+		"limit": limit,
+	})
+	return err
+}
+
+func (r *inflatedReader) Close() error {
+	err := closeAll(r.decoders)
+	if cerr := r.orig.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// closeAll closes a chain of decoders from the outermost in, as the inner
+// ones hold resources too, such as the goroutines of zstd
+func closeAll(decoders []io.ReadCloser) error {
+	var err error
+	for i := len(decoders) - 1; i >= 0; i-- {
+		if cerr := decoders[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
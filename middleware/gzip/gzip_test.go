@@ -2,9 +2,12 @@ package gzip
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -13,7 +16,9 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/andybalholm/brotli"
 	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -253,3 +258,150 @@ func TestDecompressGzipWithIncorrectData(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func compressBody(t *testing.T, encoding string, data []byte) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		w = zlib.NewWriter(buf)
+	case "br":
+		w = brotli.NewWriter(buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func newDecompressServer(opts ...DecompressOption) *gin.Engine {
+	router := gin.New()
+	router.Use(Gzip(DefaultCompression, WithDecompressFn(NewDecompressHandle(opts...))))
+	router.POST("/", func(c *gin.Context) {
+		data, err := c.GetRawData()
+		if err != nil {
+			return
+		}
+		c.Data(200, "text/plain", data)
+	})
+	return router
+}
+
+func postEncoded(router *gin.Engine, encoding string, body io.Reader) *httptest.ResponseRecorder {
+	req, _ := http.NewRequestWithContext(context.Background(), "POST", "/", body)
+	req.Header.Set("Content-Encoding", encoding)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDecompressEncodings(t *testing.T) {
+	router := newDecompressServer()
+	for _, encoding := range []string{"gzip", "deflate", "br", "zstd"} {
+		w := postEncoded(router, encoding, compressBody(t, encoding, []byte(testResponse)))
+		assert.Equal(t, http.StatusOK, w.Code, encoding)
+		assert.Equal(t, testResponse, w.Body.String(), encoding)
+	}
+
+	raw := &bytes.Buffer{}
+	fw, _ := flate.NewWriter(raw, flate.DefaultCompression)
+	_, _ = fw.Write([]byte(testResponse))
+	_ = fw.Close()
+	w := postEncoded(router, "deflate", raw)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, testResponse, w.Body.String())
+}
+
+func TestDecompressMaxInflatedSize(t *testing.T) {
+	router := newDecompressServer(WithMaxInflatedSize(1<<10), WithMaxRatio(0))
+
+	w := postEncoded(router, "gzip", compressBody(t, "gzip", bytes.Repeat([]byte("a"), 1<<10)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1<<10, w.Body.Len())
+
+	w = postEncoded(router, "zstd", compressBody(t, "zstd", bytes.Repeat([]byte("a"), 1<<10+1)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), ErrInflatedTooLarge.Error())
+}
+
+func TestDecompressMaxRatio(t *testing.T) {
+	router := newDecompressServer(WithMaxInflatedSize(1<<30), WithMaxRatio(50))
+
+	w := postEncoded(router, "gzip", compressBody(t, "gzip", bytes.Repeat([]byte("a"), 1<<20)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), ErrRatioTooLarge.Error())
+
+	// below 64KB the ratio is not checked
+	w = postEncoded(router, "gzip", compressBody(t, "gzip", bytes.Repeat([]byte("a"), 1<<15)))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestDecompressUnsupported(t *testing.T) {
+	router := newDecompressServer(WithEncodings("gzip"))
+
+	w := postEncoded(router, "br", compressBody(t, "br", []byte(testResponse)))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Accept-Encoding"))
+
+	w = postEncoded(router, "gzip", bytes.NewBufferString("not gzip"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+type closeTracker struct {
+	io.ReadCloser
+	name   string
+	closed *[]string
+}
+
+func (r closeTracker) Close() error {
+	*r.closed = append(*r.closed, r.name)
+	return r.ReadCloser.Close()
+}
+
+func TestDecompressClosesEveryDecoder(t *testing.T) {
+	var closed []string
+	tracked := map[string]newReader{}
+	for _, name := range []string{"gzip", "zstd"} {
+		name, fn := name, decoders[name]
+		tracked[name] = func(r io.Reader, maxSize int64) (io.ReadCloser, error) {
+			rc, err := fn(r, maxSize)
+			if err != nil {
+				return nil, err
+			}
+			return closeTracker{ReadCloser: rc, name: name, closed: &closed}, nil
+		}
+	}
+	d := &decompressor{maxSize: defaultMaxInflatedSize, encodings: tracked}
+	decompress := func(encoding string, body io.Reader) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequestWithContext(context.Background(), "POST", "/", body)
+		c.Request.Header.Set("Content-Encoding", encoding)
+		d.handle(c)
+		return c
+	}
+
+	body := compressBody(t, "zstd", compressBody(t, "gzip", []byte(testResponse)).Bytes())
+	c := decompress("gzip, zstd", body)
+	data, err := io.ReadAll(c.Request.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, testResponse, string(data))
+	assert.NoError(t, c.Request.Body.Close())
+	assert.Equal(t, []string{"gzip", "zstd"}, closed)
+
+	// the decoders opened before an unsupported encoding are closed too
+	closed = nil
+	c = decompress("br, zstd", compressBody(t, "zstd", []byte(testResponse)))
+	assert.Equal(t, http.StatusUnsupportedMediaType, c.Writer.Status())
+	assert.Equal(t, []string{"zstd"}, closed)
+}
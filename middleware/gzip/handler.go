@@ -37,7 +37,7 @@ func newGzipHandler(level int, options ...Option) *gzipHandler {
 }
 
 func (g *gzipHandler) Handle(c *gin.Context) {
-	if fn := g.DecompressFn; fn != nil && c.Request.Header.Get("Content-Encoding") == "gzip" {
+	if fn := g.DecompressFn; fn != nil && c.Request.Header.Get("Content-Encoding") != "" {
 		fn(c)
 	}
 
@@ -101,8 +101,10 @@ func (e ExcludedPathesRegexs) Contains(requestURI string) bool {
 	return false
 }
 
+// DefaultDecompressHandle inflates gzip request bodies without any limit, use
+// NewDecompressHandle on endpoints that accept bodies from untrusted clients
 func DefaultDecompressHandle(c *gin.Context) {
-	if c.Request.Body == nil {
+	if c.Request.Body == nil || c.Request.Header.Get("Content-Encoding") != "gzip" {
 		return
 	}
 	r, err := gzip.NewReader(c.Request.Body)
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/donetkit/contrib-gin/middleware/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditRecord is the line written to the audit sink for every request made
+// by an authenticated identity
+type AuditRecord struct {
+	Time      time.Time              `json:"time"`
+	Identity  interface{}            `json:"identity"`
+	Claims    map[string]interface{} `json:"claims,omitempty"`
+	Method    string                 `json:"method"`
+	Path      string                 `json:"path"`
+	Route     string                 `json:"route,omitempty"`
+	Status    int                    `json:"status"`
+	ClientIP  string                 `json:"client_ip"`
+	RequestId string                 `json:"request_id,omitempty"`
+	TraceId   string                 `json:"trace_id,omitempty"`
+}
+
+type auditor struct {
+	sink        *FileSink
+	identityKey string
+	claims      []string
+}
+
+// record writes the audit line of a request, requests without the identity
+// claim are not audited
+func (a *auditor) record(c *gin.Context, param *LogFormatterParams, path string) {
+	claims := jwt.ExtractClaims(c)
+	identity, ok := claims[a.identityKey]
+	if !ok {
+		return
+	}
+	rec := AuditRecord{
+		Time:      param.TimeStamp,
+		Identity:  identity,
+		Method:    param.Method,
+		Path:      path,
+		Route:     c.FullPath(),
+		Status:    param.StatusCode,
+		ClientIP:  param.ClientIP,
+		RequestId: param.RequestId,
+		TraceId:   param.TraceId,
+	}
+	for _, name := range a.claims {
+		if v, ok := claims[name]; ok {
+			if rec.Claims == nil {
+				rec.Claims = map[string]interface{}{}
+			}
+			rec.Claims[name] = v
+		}
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	_, _ = a.sink.WriteSync(append(data, '\n'))
+}
+
+// writeFile writes the access line to the file sink, without colors
+func (cfg *config) writeFile(param LogFormatterParams) {
+	param.colorMode = disableColor
+	_, _ = cfg.file.Write(append([]byte(cfg.fileFormatter(param)), '\n'))
+}
@@ -2,15 +2,193 @@ package logger
 
 import (
 	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultRequestBodyLimit  = 64 << 10
+	defaultResponseBodyLimit = 64 << 10
+
+	// truncatedMarker is appended to the captured bodies cut at the limit
+	truncatedMarker = "...[truncated]"
+	// unreadMarker is appended to request bodies the handler did not read to
+	// the end, the logger never reads the rest itself
+	unreadMarker = "...[unread]"
+)
+
+// binary content types whose bodies are never captured
+var (
+	binaryTypePrefixes = []string{"image/", "audio/", "video/", "font/", "application/grpc"}
+	binaryTypes        = map[string]bool{
+		"application/octet-stream": true,
+		"application/zip":          true,
+		"application/gzip":         true,
+		"application/x-gzip":       true,
+		"application/x-tar":        true,
+		"application/pdf":          true,
+		"application/wasm":         true,
+		"application/protobuf":     true,
+		"application/x-protobuf":   true,
+		"multipart/form-data":      true,
+	}
+)
+
+func isBinary(contentType string) bool {
+	if binaryTypes[contentType] {
+		return true
+	}
+	for _, prefix := range binaryTypePrefixes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// capture keeps the first limit bytes written to it and remembers whether
+// more followed
+type capture struct {
+	buf         bytes.Buffer
+	limit       int
+	truncated   bool
+	contentType string
+	binary      bool
+	reader      *bodyReader
+}
+
+func (b *capture) write(p []byte) {
+	if b.binary || len(p) == 0 {
+		return
+	}
+	room := b.limit - b.buf.Len()
+	if room < 0 {
+		room = 0
+	}
+	if len(p) > room {
+		p = p[:room]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+}
+
+// data returns the captured body, or a note naming the content type of a
+// binary body
+func (b *capture) data() string {
+	if b == nil {
+		return ""
+	}
+	if b.binary {
+		return "[binary " + b.contentType + "]"
+	}
+	return b.buf.String()
+}
+
+// unread reports whether the handler left part of the request body unread
+// below the limit
+func (b *capture) unread() bool {
+	if b.reader == nil || b.reader.done || b.truncated {
+		return false
+	}
+	return b.reader.length < 0 || b.reader.read < b.reader.length
+}
+
+// bodyReader tees what the handler reads from the request body into a
+// capture, the handler reads at its own pace
+type bodyReader struct {
+	io.ReadCloser
+	capture *capture
+	length  int64
+	read    int64
+	done    bool
+}
+
+func newBodyReader(c *gin.Context, limit int) *capture {
+	b := &capture{limit: limit, contentType: c.ContentType()}
+	b.binary = isBinary(b.contentType)
+	if c.Request.Body != nil && c.Request.Body != http.NoBody && !b.binary {
+		b.reader = &bodyReader{ReadCloser: c.Request.Body, capture: b, length: c.Request.ContentLength}
+		c.Request.Body = b.reader
+	}
+	return b
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.capture.write(p[:n])
+	r.read += int64(n)
+	r.done = err != nil
+	return n, err
+}
+
+// bodyWriter tees the response into a capture, writes, flushes and hijacks
+// go straight to the wrapped writer
 type bodyWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	capture *capture
+	sniffed bool
+}
+
+func newBodyWriter(c *gin.Context, limit int) *capture {
+	w := &bodyWriter{ResponseWriter: c.Writer, capture: &capture{limit: limit}}
+	c.Writer = w
+	return w.capture
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	w.sniff(b)
+	w.capture.write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	if !w.capture.binary {
+		b := []byte(s)
+		w.sniff(b)
+		w.capture.write(b)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// sniff decides on the first write whether the response is binary, from its
+// Content-Type or from the first bytes as net/http would
+func (w *bodyWriter) sniff(b []byte) {
+	if w.sniffed {
+		return
+	}
+	w.sniffed = true
+	ct := w.Header().Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(b)
+	}
+	w.capture.contentType = contentType(ct)
+	w.capture.binary = isBinary(w.capture.contentType)
+}
+
+// setBodies copies the captured bodies into the params, nil captures are
+// routes logged without bodies
+func setBodies(param *LogFormatterParams, request, response *capture) {
+	if request != nil {
+		param.RequestData, param.RequestTruncated = request.data(), request.truncated
+		param.RequestUnread = request.unread()
+	}
+	if response != nil {
+		param.ResponseData, param.ResponseTruncated = response.data(), response.truncated
+	}
 }
 
-func (r bodyWriter) Write(b []byte) (int, error) {
-	r.body.Write(b)
-	return r.ResponseWriter.Write(b)
+// markTruncated appends truncatedMarker to the cut bodies and unreadMarker
+// to the request body read in part, once they are redacted
+func markTruncated(param *LogFormatterParams) {
+	if param.RequestTruncated {
+		param.RequestData += truncatedMarker
+	} else if param.RequestUnread {
+		param.RequestData += unreadMarker
+	}
+	if param.ResponseTruncated {
+		param.ResponseData += truncatedMarker
+	}
 }
@@ -0,0 +1,139 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/donetkit/contrib-log/glog"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBodyRouter(opts ...Option) (*gin.Engine, **LogFormatterParams) {
+	var logged *LogFormatterParams
+	r := gin.New()
+	r.Use(New(append([]Option{
+		WithLogger(glog.New()),
+		WithBodyLimit(16, 16),
+		WithWriterLogFn(func(c *gin.Context, log *LogFormatterParams) {
+			logged = log
+		}),
+	}, opts...)...))
+	return r, &logged
+}
+
+func TestBodyCaptureTruncates(t *testing.T) {
+	r, logged := newBodyRouter()
+	var read int64
+	r.POST("/upload", func(c *gin.Context) {
+		read, _ = io.Copy(io.Discard, c.Request.Body)
+		c.String(http.StatusOK, strings.Repeat("b", 1<<20))
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(bytes.Repeat([]byte("a"), 1<<20)))
+	req.Header.Set("Content-Type", gin.MIMEPlain)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, int64(1<<20), read)
+	assert.Equal(t, 1<<20, w.Body.Len())
+	assert.Equal(t, strings.Repeat("a", 16)+truncatedMarker, (*logged).RequestData)
+	assert.Equal(t, strings.Repeat("b", 16)+truncatedMarker, (*logged).ResponseData)
+	assert.True(t, (*logged).RequestTruncated)
+	assert.True(t, (*logged).ResponseTruncated)
+}
+
+func TestBodyCaptureUnread(t *testing.T) {
+	r, logged := newBodyRouter()
+	r.POST("/ignore", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	r.POST("/peek", func(c *gin.Context) {
+		_, _ = io.ReadFull(c.Request.Body, make([]byte, 3))
+		c.Status(http.StatusNoContent)
+	})
+	r.POST("/exact", func(c *gin.Context) {
+		_, _ = io.ReadFull(c.Request.Body, make([]byte, c.Request.ContentLength))
+		c.Status(http.StatusNoContent)
+	})
+
+	// the logger never reads what the handler left
+	body := strings.NewReader("short")
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/ignore", body))
+	assert.Equal(t, 5, body.Len())
+	assert.Equal(t, unreadMarker, (*logged).RequestData)
+	assert.True(t, (*logged).RequestUnread)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/peek", strings.NewReader("short")))
+	assert.Equal(t, "sho"+unreadMarker, (*logged).RequestData)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/exact", strings.NewReader("short")))
+	assert.Equal(t, "short", (*logged).RequestData)
+	assert.False(t, (*logged).RequestUnread)
+}
+
+func TestBodyCaptureNegativeLimit(t *testing.T) {
+	r, logged := newBodyRouter(WithBodyLimit(-1, -1))
+	r.POST("/echo", func(c *gin.Context) {
+		data, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(data))
+	})
+
+	w := httptest.NewRecorder()
+	assert.NotPanics(t, func() {
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("body")))
+	})
+	assert.Equal(t, "body", w.Body.String())
+	assert.Equal(t, truncatedMarker, (*logged).RequestData)
+}
+
+func TestBodyCaptureStreams(t *testing.T) {
+	r, logged := newBodyRouter()
+	r.GET("/stream", func(c *gin.Context) {
+		for i := 0; i < 3; i++ {
+			_, _ = c.Writer.WriteString("chunk-")
+			c.Writer.Flush()
+		}
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "chunk-chunk-chunk-", w.Body.String())
+	assert.Equal(t, "chunk-chunk-chun"+truncatedMarker, (*logged).ResponseData)
+}
+
+func TestBodyCaptureSkipsBinary(t *testing.T) {
+	r, logged := newBodyRouter()
+	var body io.ReadCloser
+	r.POST("/image", func(c *gin.Context) {
+		body = c.Request.Body
+		c.Data(http.StatusOK, "image/png", []byte("\x89PNG\r\n\x1a\n"))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/image", strings.NewReader("raw bytes"))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	_, wrapped := body.(*bodyReader)
+	assert.False(t, wrapped)
+	assert.Equal(t, "[binary application/octet-stream]", (*logged).RequestData)
+	assert.Equal(t, "[binary image/png]", (*logged).ResponseData)
+}
+
+func TestBodyCaptureRedactsCutJSON(t *testing.T) {
+	r, logged := newBodyRouter(WithRedactJSONPaths("password"))
+	r.POST("/login", func(c *gin.Context) {
+		_, _ = io.Copy(io.Discard, c.Request.Body)
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"user":"gin","password":"secret"}`))
+	req.Header.Set("Content-Type", gin.MIMEJSON)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, Redacted+truncatedMarker, (*logged).RequestData)
+}
@@ -0,0 +1,204 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donetkit/contrib-log/glog"
+	"github.com/sirupsen/logrus"
+)
+
+// FieldsFormatter gives the signature of the structured formatters passed to
+// WithFieldsFormatter, the fields are attached to the glog entry
+type FieldsFormatter func(params LogFormatterParams) map[string]interface{}
+
+// ecsVersion is the Elastic Common Schema version of ECSFields
+const ecsVersion = "8.11.0"
+
+// JSONFields returns every param under snake case keys, empty values are left out
+func JSONFields(param LogFormatterParams) map[string]interface{} {
+	fields := map[string]interface{}{
+		"time":       param.TimeStamp.Format(time.RFC3339Nano),
+		"status":     param.StatusCode,
+		"latency_ms": float64(param.Latency) / float64(time.Millisecond),
+		"client_ip":  param.ClientIP,
+		"method":     param.Method,
+		"path":       param.Path,
+		"body_size":  param.BodySize,
+	}
+	optional := map[string]string{
+		"proto":         param.RequestProto,
+		"user_agent":    param.RequestUserAgent,
+		"referer":       param.RequestReferer,
+		"request_id":    param.RequestId,
+		"trace_id":      param.TraceId,
+		"span_id":       param.SpanId,
+		"error":         param.ErrorMessage,
+		"request_body":  param.RequestData,
+		"response_body": param.ResponseData,
+	}
+	for k, v := range optional {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	if len(param.Keys) > 0 {
+		if _, err := json.Marshal(param.Keys); err == nil {
+			fields["keys"] = param.Keys
+		}
+	}
+	return fields
+}
+
+// ECSFields returns the params under Elastic Common Schema field names
+func ECSFields(param LogFormatterParams) map[string]interface{} {
+	fields := map[string]interface{}{
+		"@timestamp":                param.TimeStamp.Format(time.RFC3339Nano),
+		"ecs.version":               ecsVersion,
+		"event.kind":                "event",
+		"event.category":            "web",
+		"event.duration":            param.Latency.Nanoseconds(),
+		"http.request.method":       param.Method,
+		"http.response.status_code": param.StatusCode,
+		"http.response.body.bytes":  param.BodySize,
+		"url.original":              param.Path,
+		"client.ip":                 param.ClientIP,
+	}
+	optional := map[string]string{
+		"http.version":               strings.TrimPrefix(param.RequestProto, "HTTP/"),
+		"user_agent.original":        param.RequestUserAgent,
+		"http.request.referrer":      param.RequestReferer,
+		"http.request.id":            param.RequestId,
+		"trace.id":                   param.TraceId,
+		"span.id":                    param.SpanId,
+		"error.message":              param.ErrorMessage,
+		"http.request.body.content":  param.RequestData,
+		"http.response.body.content": param.ResponseData,
+	}
+	for k, v := range optional {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	if param.StatusCode >= 500 || param.ErrorMessage != "" {
+		fields["event.outcome"] = "failure"
+	} else {
+		fields["event.outcome"] = "success"
+	}
+	return fields
+}
+
+// JSONFormatter renders JSONFields as one JSON object per line
+func JSONFormatter(param LogFormatterParams) string {
+	return marshal(JSONFields(param))
+}
+
+// ECSFormatter renders ECSFields as one JSON object per line
+func ECSFormatter(param LogFormatterParams) string {
+	return marshal(ECSFields(param))
+}
+
+// LogfmtFormatter renders JSONFields as logfmt key=value pairs
+func LogfmtFormatter(param LogFormatterParams) string {
+	fields := JSONFields(param)
+	delete(fields, "keys")
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return logfmtOrder(keys[i]) < logfmtOrder(keys[j]) ||
+			logfmtOrder(keys[i]) == logfmtOrder(keys[j]) && keys[i] < keys[j]
+	})
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(fmt.Sprint(fields[k])))
+	}
+	return b.String()
+}
+
+// CombinedLogFormatter renders the Apache Combined Log Format
+func CombinedLogFormatter(param LogFormatterParams) string {
+	proto := param.RequestProto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	size := "-"
+	if param.BodySize > 0 {
+		size = strconv.Itoa(param.BodySize)
+	}
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s %s %s",
+		dash(param.ClientIP),
+		param.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
+		param.Method, param.Path, proto,
+		param.StatusCode,
+		size,
+		strconv.Quote(dash(param.RequestReferer)),
+		strconv.Quote(dash(param.RequestUserAgent)),
+	)
+}
+
+// emit writes an access line at level, as fields when a FieldsFormatter is set
+func (cfg *config) emit(level glog.Level, param LogFormatterParams) {
+	if cfg.fieldsFormatter != nil {
+		if entry, ok := cfg.logger.(interface {
+			WithFields(fields logrus.Fields) *logrus.Entry
+		}); ok {
+			if level < glog.ErrorLevel {
+				level = glog.ErrorLevel
+			}
+			msg := fmt.Sprintf("%s %s %d", param.Method, param.Path, param.StatusCode)
+			entry.WithFields(cfg.fieldsFormatter(param)).Log(logrus.Level(level), msg)
+			return
+		}
+	}
+	logAt(cfg.logger, level, cfg.formatter(param))
+}
+
+func marshal(fields map[string]interface{}) string {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q}`, err.Error())
+	}
+	return string(data)
+}
+
+// logfmtOrder puts the request line first, then everything else by name
+func logfmtOrder(key string) int {
+	switch key {
+	case "time":
+		return 0
+	case "method":
+		return 1
+	case "path":
+		return 2
+	case "status":
+		return 3
+	case "latency_ms":
+		return 4
+	}
+	return 5
+}
+
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\t\r\n") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+func dash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
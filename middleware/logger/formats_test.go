@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+var testParams = LogFormatterParams{
+	TimeStamp:        time.Date(2023, 10, 10, 13, 55, 36, 0, time.UTC),
+	StatusCode:       200,
+	Latency:          1500 * time.Microsecond,
+	ClientIP:         "127.0.0.1",
+	Method:           http.MethodGet,
+	Path:             "/users?page=1",
+	BodySize:         2326,
+	RequestProto:     "HTTP/1.1",
+	RequestUserAgent: "Mozilla/4.08",
+	RequestReferer:   "http://www.example.com/start.html",
+	RequestId:        "rid",
+	TraceId:          "4bf92f3577b34da6a3ce929d0e0e4736",
+	SpanId:           "00f067aa0ba902b7",
+}
+
+func TestJSONFormatter(t *testing.T) {
+	var fields map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(JSONFormatter(testParams)), &fields))
+	assert.Equal(t, "/users?page=1", fields["path"])
+	assert.Equal(t, float64(200), fields["status"])
+	assert.Equal(t, 1.5, fields["latency_ms"])
+	assert.Equal(t, "rid", fields["request_id"])
+	assert.Equal(t, "Mozilla/4.08", fields["user_agent"])
+	assert.NotContains(t, fields, "error")
+}
+
+func TestECSFormatter(t *testing.T) {
+	var fields map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(ECSFormatter(testParams)), &fields))
+	assert.Equal(t, "2023-10-10T13:55:36Z", fields["@timestamp"])
+	assert.Equal(t, float64(1500000), fields["event.duration"])
+	assert.Equal(t, "1.1", fields["http.version"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fields["trace.id"])
+	assert.Equal(t, "success", fields["event.outcome"])
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	param := testParams
+	param.ErrorMessage = "not found"
+	assert.Equal(t,
+		`time=2023-10-10T13:55:36Z method=GET path="/users?page=1" status=200 latency_ms=1.5 body_size=2326 client_ip=127.0.0.1 `+
+			`error="not found" proto=HTTP/1.1 referer=http://www.example.com/start.html request_id=rid span_id=00f067aa0ba902b7 `+
+			`trace_id=4bf92f3577b34da6a3ce929d0e0e4736 user_agent=Mozilla/4.08`,
+		LogfmtFormatter(param))
+}
+
+func TestCombinedLogFormatter(t *testing.T) {
+	assert.Equal(t,
+		`127.0.0.1 - - [10/Oct/2023:13:55:36 +0000] "GET /users?page=1 HTTP/1.1" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+		CombinedLogFormatter(testParams))
+}
+
+func TestFieldsFormatter(t *testing.T) {
+	r, hook := newCapturedRouter(WithFieldsFormatter(ECSFields), WithRouteBodies("/ok", false))
+	req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry *logrus.Entry
+	for _, e := range hook.entries {
+		if e.Level == logrus.InfoLevel {
+			entry = e
+		}
+	}
+	if !assert.NotNil(t, entry) {
+		return
+	}
+	assert.Equal(t, "GET /ok 200", entry.Message)
+	assert.Equal(t, "test-agent", entry.Data["user_agent.original"])
+	assert.Equal(t, http.StatusOK, entry.Data["http.response.status_code"])
+}
@@ -1,18 +1,17 @@
 package logger
 
 import (
-	"bytes"
 	"fmt"
+	"github.com/donetkit/contrib-gin/middleware/requestid"
+	"github.com/donetkit/contrib-log/glog"
 	"github.com/gin-gonic/gin"
-	"io"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"net/http"
 	"regexp"
 	"runtime/debug"
 	"time"
 )
 
-var cfg *config
-
 type consoleColorModeValue int
 
 type RequestLabelMappingFn func(c *gin.Context) string
@@ -34,8 +33,6 @@ const (
 	reset   = "\033[0m"
 )
 
-var consoleColorMode = autoColor
-
 // LogFormatter gives the signature of the formatter function passed to LoggerWithFormatter
 type LogFormatter func(params LogFormatterParams) string
 
@@ -57,9 +54,11 @@ type LogFormatterParams struct {
 	ErrorMessage string
 	// isTerm shows whether does gin's output descriptor refers to a terminal.
 	isTerm bool
+	// colorMode is the console color mode of the logger instance
+	colorMode consoleColorModeValue
 	// BodySize is the size of the Response Body
 	BodySize int
-	// Keys are the keys set on the request's context.
+	// Keys are the keys of WithLogKeys set on the request's context.
 	Keys map[string]interface{}
 
 	RequestData      string
@@ -72,6 +71,18 @@ type LogFormatterParams struct {
 	SpanId    string
 
 	ResponseData string
+
+	// RequestTruncated and ResponseTruncated are set when a body was cut at
+	// the WithBodyLimit size
+	RequestTruncated  bool
+	ResponseTruncated bool
+	// RequestUnread is set when the handler did not read the request body to
+	// the end, RequestData only holds what it read
+	RequestUnread bool
+
+	// RequestHeader and ResponseHeader are copies with sensitive values masked
+	RequestHeader  http.Header
+	ResponseHeader http.Header
 }
 
 // StatusCodeColor is the ANSI color for appropriately logging http status code to a terminal.
@@ -119,7 +130,7 @@ func (p *LogFormatterParams) ResetColor() string {
 
 // IsOutputColor indicates whether can colors be outputted to the log.
 func (p *LogFormatterParams) IsOutputColor() bool {
-	return consoleColorMode == forceColor || (consoleColorMode == autoColor && p.isTerm)
+	return p.colorMode == forceColor || (p.colorMode == autoColor && p.isTerm)
 }
 
 // defaultLogFormatter is the default log format function Logger middleware uses.
@@ -147,25 +158,16 @@ var defaultLogFormatter = func(param LogFormatterParams) string {
 	)
 }
 
-// disableConsoleColor disables color output in the console serve.
-func disableConsoleColor() {
-	consoleColorMode = disableColor
-}
-
-// forceConsoleColor force color output in the console serve.
-func forceConsoleColor() {
-	consoleColorMode = forceColor
-}
-
-// NewErrorLogger returns a handler func for any error type.
-func NewErrorLogger(opts ...Option) gin.HandlerFunc {
-	if cfg == nil {
-		cfg = &config{
-			consoleColor: true,
-			endpointLabelMappingFn: func(c *gin.Context) string {
-				return c.Request.URL.Path
-			}}
-	}
+// newConfig returns the config of one logger instance, instances share nothing
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		consoleColor:      true,
+		redactor:          newRedactor(),
+		requestBodyLimit:  defaultRequestBodyLimit,
+		responseBodyLimit: defaultResponseBodyLimit,
+		endpointLabelMappingFn: func(c *gin.Context) string {
+			return c.Request.URL.Path
+		}}
 	for _, opt := range opts {
 		opt(cfg)
 	}
@@ -173,24 +175,34 @@ func NewErrorLogger(opts ...Option) gin.HandlerFunc {
 		cfg.formatter = defaultLogFormatter
 	}
 	if cfg.consoleColor {
-		forceConsoleColor()
+		cfg.colorMode = forceColor
 	} else {
-		disableConsoleColor()
+		cfg.colorMode = disableColor
 	}
-	return ErrorLoggerT(gin.ErrorTypeAny)
+	return cfg
+}
+
+// NewErrorLogger returns a handler func for any error type.
+func NewErrorLogger(opts ...Option) gin.HandlerFunc {
+	return newConfig(opts).errorLogger(gin.ErrorTypeAny)
 }
 
 // ErrorLoggerT returns a handler func for a given error type.
-func ErrorLoggerT(typ gin.ErrorType) gin.HandlerFunc {
+func ErrorLoggerT(typ gin.ErrorType, opts ...Option) gin.HandlerFunc {
+	return newConfig(opts).errorLogger(typ)
+}
+
+func (cfg *config) errorLogger(typ gin.ErrorType) gin.HandlerFunc {
 	isTerm := true
 	return func(c *gin.Context) {
+		reqBody := newBodyReader(c, cfg.requestBodyLimit)
+		respBody := newBodyWriter(c, cfg.responseBodyLimit)
 		defer func() {
 			if errRecover := recover(); errRecover != nil {
-				if cfg.logger == nil {
-					return
-				}
 				var recoverErr = fmt.Sprintf("%s", errRecover)
-				cfg.logger.Error(string(debug.Stack()))
+				if cfg.logger != nil {
+					cfg.logger.Error(string(debug.Stack()))
+				}
 				start := time.Now() // Start timer
 				method := c.Request.Method
 				endpoint := cfg.endpointLabelMappingFn(c)
@@ -198,14 +210,11 @@ func ErrorLoggerT(typ gin.ErrorType) gin.HandlerFunc {
 				if !isOk {
 					return
 				}
-				rawData, err := c.GetRawData()
-				if err == nil {
-					c.Request.Body = io.NopCloser(bytes.NewBuffer(rawData))
-				}
 				raw := c.Request.URL.RawQuery
 				param := LogFormatterParams{
-					isTerm: isTerm,
-					Keys:   c.Keys,
+					isTerm:    isTerm,
+					colorMode: cfg.colorMode,
+					Keys:      c.Keys,
 				}
 				// Stop timer
 				param.ClientIP = c.ClientIP()
@@ -222,29 +231,15 @@ func ErrorLoggerT(typ gin.ErrorType) gin.HandlerFunc {
 				param.RequestProto = c.Request.Proto
 				param.RequestUserAgent = c.Request.UserAgent()
 				param.RequestReferer = c.Request.Referer()
-				param.RequestId = c.Request.Header.Get("X-Request-Id")
-				param.TraceId = c.Request.Header.Get("trace-id")
-				param.SpanId = c.Request.Header.Get("span-id")
-
-				writer := &bodyWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-				c.Writer = writer
-
-				if len(rawData) <= 1024*1024 {
-					param.RequestData = string(rawData)
-				} else {
-					param.RequestData = fmt.Sprintf("request data is too large, limit size: %d", 1024*1024)
-				}
-
-				if writer.body.Len() <= 1024*1024*2 {
-					param.ResponseData = writer.body.String()
-				} else {
-					param.ResponseData = fmt.Sprintf("response data is too large, limit size: %d", 1024*1024*2)
-				}
-
-				cfg.logger.Debug(param.RequestData)
-				cfg.logger.Debug(param.ResponseData)
+				param.RequestId = requestID(c)
+				param.TraceId, param.SpanId = traceIDs(c)
+				param.RequestHeader = c.Request.Header
+				param.ResponseHeader = c.Writer.Header()
+				setBodies(&param, reqBody, respBody)
+				cfg.redactor.redact(c, &param)
+				markTruncated(&param)
 
-				cfg.logger.Infof("%s", cfg.formatter(param))
+				cfg.write(glog.InfoLevel, param, true)
 
 				if cfg.writerErrorFn != nil {
 					code, msg := cfg.writerErrorFn(c, &param)
@@ -263,28 +258,11 @@ func ErrorLoggerT(typ gin.ErrorType) gin.HandlerFunc {
 
 // New instances a Logger middleware that will write the logs to gin.DefaultWriter. By default gin.DefaultWriter = os.Stdout.
 func New(opts ...Option) gin.HandlerFunc {
-	if cfg == nil {
-		cfg = &config{
-			consoleColor: true,
-			endpointLabelMappingFn: func(c *gin.Context) string {
-				return c.Request.URL.Path
-			}}
-	}
-	for _, opt := range opts {
-		opt(cfg)
-	}
-	if cfg.formatter == nil {
-		cfg.formatter = defaultLogFormatter
-	}
-	if cfg.consoleColor {
-		forceConsoleColor()
-	} else {
-		disableConsoleColor()
-	}
+	cfg := newConfig(opts)
 	isTerm := true
 	//gin.DefaultWriter = &writeLogger{pool: buffer.Pool{}}
 	return func(c *gin.Context) {
-		if cfg.logger == nil {
+		if cfg.logger == nil && cfg.file == nil && cfg.audit == nil {
 			return
 		}
 		start := time.Now() // Start timer
@@ -294,18 +272,19 @@ func New(opts ...Option) gin.HandlerFunc {
 		if !isOk {
 			return
 		}
-		rawData, err := c.GetRawData()
-		if err == nil {
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(rawData))
+		level, bodies := cfg.routeOf(c)
+		var reqBody, respBody *capture
+		if bodies {
+			reqBody = newBodyReader(c, cfg.requestBodyLimit)
+			respBody = newBodyWriter(c, cfg.responseBodyLimit)
 		}
-		writer := &bodyWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-		c.Writer = writer
 		// Process request
 		c.Next()
 		raw := c.Request.URL.RawQuery
 		param := LogFormatterParams{
-			isTerm: isTerm,
-			Keys:   c.Keys,
+			isTerm:    isTerm,
+			colorMode: cfg.colorMode,
+			Keys:      c.Keys,
 		}
 		// Stop timer
 		param.ClientIP = c.ClientIP()
@@ -319,37 +298,47 @@ func New(opts ...Option) gin.HandlerFunc {
 		param.TimeStamp = time.Now()
 		param.Latency = param.TimeStamp.Sub(start)
 		param.ErrorMessage = c.Errors.ByType(gin.ErrorTypePrivate).String()
-
-		if len(rawData) <= 1024*1024 {
-			param.RequestData = string(rawData)
-		} else {
-			param.RequestData = fmt.Sprintf("request data is too large, limit size: %d", 1024*1024)
+		param.RequestProto = c.Request.Proto
+		param.RequestUserAgent = c.Request.UserAgent()
+		param.RequestReferer = c.Request.Referer()
+		param.RequestId = requestID(c)
+		param.TraceId, param.SpanId = traceIDs(c)
+		if cfg.audit != nil {
+			cfg.audit.record(c, &param, cfg.redactor.path(param.Path))
 		}
-
-		if writer.body.Len() <= 1024*1024*2 {
-			param.ResponseData = writer.body.String()
-		} else {
-			param.ResponseData = fmt.Sprintf("response data is too large, limit size: %d", 1024*1024*2)
+		if !cfg.admit(c, &param) {
+			return
 		}
 
-		cfg.logger.Debug(param.RequestData)
-		cfg.logger.Debug(param.ResponseData)
-
-		cfg.logger.Infof("%s", cfg.formatter(param))
+		setBodies(&param, reqBody, respBody)
+		param.RequestHeader = c.Request.Header
+		param.ResponseHeader = c.Writer.Header()
+		cfg.redactor.redact(c, &param)
+		markTruncated(&param)
+		cfg.write(level, param, bodies)
 
 		if cfg.writerLogFn != nil {
-			param.RequestProto = c.Request.Proto
-			param.RequestUserAgent = c.Request.UserAgent()
-			param.RequestReferer = c.Request.Referer()
-			param.RequestId = c.Request.Header.Get("X-Request-Id")
-			param.TraceId = c.Request.Header.Get("trace-id")
-			param.SpanId = c.Request.Header.Get("span-id")
 			cfg.writerLogFn(c, &param)
 		}
 
 	}
 }
 
+// write logs the access line to the glog logger, with the bodies at Debug,
+// and to the file sink
+func (cfg *config) write(level glog.Level, param LogFormatterParams, bodies bool) {
+	if cfg.logger != nil {
+		if bodies {
+			cfg.logger.Debug(param.RequestData)
+			cfg.logger.Debug(param.ResponseData)
+		}
+		cfg.emit(level, param)
+	}
+	if cfg.file != nil {
+		cfg.writeFile(param)
+	}
+}
+
 // checkLabel returns the match result of labels.
 // Return true if regex-pattern compiles failed.
 func (c *config) checkLabel(label string, patterns []string) bool {
@@ -370,3 +359,19 @@ func (c *config) checkLabel(label string, patterns []string) bool {
 	}
 	return true
 }
+
+// requestID prefers the id set by the requestid middleware over the request header
+func requestID(c *gin.Context) string {
+	if id := requestid.FromContext(c.Request.Context()); id != "" {
+		return id
+	}
+	return c.Request.Header.Get("X-Request-Id")
+}
+
+// traceIDs prefers the span started by gintrace over the request headers
+func traceIDs(c *gin.Context) (string, string) {
+	if sc := oteltrace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+		return sc.TraceID().String(), sc.SpanID().String()
+	}
+	return c.Request.Header.Get("trace-id"), c.Request.Header.Get("span-id")
+}
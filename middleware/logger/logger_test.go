@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/donetkit/contrib-log/glog"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndependentInstances(t *testing.T) {
+	public, admin := glog.New(), glog.New()
+	publicHook, adminHook := &captureHook{}, &captureHook{}
+	public.AddHook(publicHook)
+	admin.AddHook(adminHook)
+
+	var publicLines, adminLines []string
+	r := gin.New()
+	r.Group("/public", New(WithLogger(public), WithFormatter(func(p LogFormatterParams) string {
+		publicLines = append(publicLines, p.Path)
+		return "public " + p.Path
+	}))).GET("/a", func(c *gin.Context) {
+		c.String(http.StatusOK, "a")
+	})
+	r.Group("/admin", New(WithLogger(admin), WithConsoleColor(false), WithExcludeRegexEndpoint([]string{"^/admin/health"}), WithFormatter(func(p LogFormatterParams) string {
+		adminLines = append(adminLines, p.Path)
+		assert.False(t, p.IsOutputColor())
+		return "admin " + p.Path
+	}))).GET("/b", func(c *gin.Context) {
+		c.String(http.StatusOK, "b")
+	}).GET("/health", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	for _, path := range []string{"/public/a", "/admin/b", "/admin/health"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, []string{"/public/a"}, publicLines)
+	assert.Equal(t, []string{"/admin/b"}, adminLines)
+	assert.Equal(t, 1, publicHook.count(logrus.InfoLevel))
+	assert.Equal(t, 1, adminHook.count(logrus.InfoLevel))
+}
+
+func TestConcurrentConstruction(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = New(WithRouteLevel("/", glog.DebugLevel), WithRedactFormFields("password"))
+			_ = NewErrorLogger(WithConsoleColor(false))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestErrorLoggerWithoutLogger(t *testing.T) {
+	r := gin.New()
+	r.Use(NewErrorLogger(WithWriterErrorFn(func(c *gin.Context, log *LogFormatterParams) (int, interface{}) {
+		return http.StatusInternalServerError, log.ErrorMessage
+	})))
+	r.GET("/", func(c *gin.Context) {
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, `"boom"`, w.Body.String())
+}
@@ -1,6 +1,11 @@
 package logger
 
 import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/donetkit/contrib-gin/middleware/jwt"
 	"github.com/donetkit/contrib-log/glog"
 	"github.com/gin-gonic/gin"
 )
@@ -15,8 +20,18 @@ type config struct {
 	excludeRegexMethod     []string
 	endpointLabelMappingFn RequestLabelMappingFn
 	consoleColor           bool
+	colorMode              consoleColorModeValue
 	writerLogFn            WriterLogFn
 	writerErrorFn          WriterErrorFn
+	redactor               *redactor
+	sampler                *sampler
+	routes                 map[string]route
+	fieldsFormatter        FieldsFormatter
+	requestBodyLimit       int
+	responseBodyLimit      int
+	file                   *FileSink
+	fileFormatter          LogFormatter
+	audit                  *auditor
 }
 
 // Option for queue system
@@ -68,6 +83,14 @@ func WithFormatter(formatter LogFormatter) Option {
 	}
 }
 
+// WithFieldsFormatter log the fields of formatter, such as JSONFields or
+// ECSFields, on the glog entry instead of a rendered line
+func WithFieldsFormatter(formatter FieldsFormatter) Option {
+	return func(cfg *config) {
+		cfg.fieldsFormatter = formatter
+	}
+}
+
 // WithConsoleColor set consoleColor function
 func WithConsoleColor(consoleColor bool) Option {
 	return func(cfg *config) {
@@ -88,3 +111,151 @@ func WithWriterErrorFn(fn WriterErrorFn) Option {
 		cfg.writerErrorFn = fn
 	}
 }
+
+// WithBodyLimit set how many bytes of the request and response bodies are
+// kept for the logs (default 64KB each), the rest still streams through.
+// Negative limits are taken as 0.
+func WithBodyLimit(request, response int) Option {
+	if request < 0 {
+		request = 0
+	}
+	if response < 0 {
+		response = 0
+	}
+	return func(cfg *config) {
+		cfg.requestBodyLimit = request
+		cfg.responseBodyLimit = response
+	}
+}
+
+// WithFileSink also write the access lines to sink, rendered by formatter
+// (default JSONFormatter) and without colors. Lines go to the file with or
+// without a glog logger, after sampling and the rate limit.
+func WithFileSink(sink *FileSink, formatter LogFormatter) Option {
+	return func(cfg *config) {
+		if formatter == nil {
+			formatter = JSONFormatter
+		}
+		cfg.file = sink
+		cfg.fileFormatter = formatter
+	}
+}
+
+// WithAudit write an AuditRecord to sink for every request carrying the
+// identityKey claim (default jwt.IdentityKey) of jwt.ExtractClaims, with the
+// listed claims. Audit lines skip sampling and the rate limit, and are written
+// and fsynced with WriteSync before the request returns.
+func WithAudit(sink *FileSink, identityKey string, claims ...string) Option {
+	return func(cfg *config) {
+		if identityKey == "" {
+			identityKey = jwt.IdentityKey
+		}
+		cfg.audit = &auditor{sink: sink, identityKey: identityKey, claims: claims}
+	}
+}
+
+// WithRedactHeaders mask more headers in logs, Authorization,
+// Proxy-Authorization, Cookie and Set-Cookie are always masked
+func WithRedactHeaders(headers ...string) Option {
+	return func(cfg *config) {
+		for _, h := range headers {
+			cfg.redactor.headers[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+}
+
+// WithRedactJSONPaths mask the values at these gjson paths, such as password
+// or users.#.token, in JSON request and response bodies
+func WithRedactJSONPaths(paths ...string) Option {
+	return func(cfg *config) {
+		cfg.redactor.paths = append(cfg.redactor.paths, paths...)
+	}
+}
+
+// WithRedactFormFields mask these fields in urlencoded bodies and query strings
+func WithRedactFormFields(fields ...string) Option {
+	return func(cfg *config) {
+		for _, f := range fields {
+			cfg.redactor.fields[f] = true
+		}
+	}
+}
+
+// WithRedactPatterns mask the matches of these regexps, such as
+// CardNumberPattern, in bodies, paths and error messages
+func WithRedactPatterns(patterns ...string) Option {
+	return func(cfg *config) {
+		for _, p := range patterns {
+			cfg.redactor.patterns = append(cfg.redactor.patterns, regexp.MustCompile(p))
+		}
+	}
+}
+
+// WithLogKeys log these keys of the request context, such as a tenant id, in
+// the keys field of the formatters. No key is logged by default, the context
+// may hold credentials.
+func WithLogKeys(keys ...string) Option {
+	return func(cfg *config) {
+		for _, k := range keys {
+			cfg.redactor.keys[k] = true
+		}
+	}
+}
+
+// WithSampling log every error (status 400 and above or c.Errors) and every
+// request slower than slow, but only one in every successful requests
+func WithSampling(every int, slow time.Duration) Option {
+	return func(cfg *config) {
+		if cfg.sampler == nil {
+			cfg.sampler = &sampler{}
+		}
+		if every > 0 {
+			cfg.sampler.every = uint64(every)
+		}
+		cfg.sampler.slow = slow
+	}
+}
+
+// WithRateLimit write at most perSecond access lines per second, a
+// "dropped N lines" warning precedes the next line written
+func WithRateLimit(perSecond int) Option {
+	return func(cfg *config) {
+		if cfg.sampler == nil {
+			cfg.sampler = &sampler{}
+		}
+		cfg.sampler.bucket = nil
+		if perSecond > 0 {
+			cfg.sampler.bucket = newTokenBucket(perSecond)
+		}
+	}
+}
+
+// WithRouteLevel set the level of the access lines of a route template as
+// returned by c.FullPath, instead of Info
+func WithRouteLevel(path string, level glog.Level) Option {
+	return func(cfg *config) {
+		r := cfg.route(path)
+		r.level = level
+		cfg.routes[path] = r
+	}
+}
+
+// WithRouteBodies turn the capture of the request and response bodies of a
+// route template on or off
+func WithRouteBodies(path string, capture bool) Option {
+	return func(cfg *config) {
+		r := cfg.route(path)
+		r.bodies = capture
+		cfg.routes[path] = r
+	}
+}
+
+func (cfg *config) route(path string) route {
+	if cfg.routes == nil {
+		cfg.routes = map[string]route{}
+	}
+	if r, ok := cfg.routes[path]; ok {
+		return r
+	}
+	return route{level: glog.InfoLevel, bodies: true}
+}
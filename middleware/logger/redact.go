@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Redacted replaces the sensitive values in access logs
+const Redacted = "[REDACTED]"
+
+// CardNumberPattern matches payment card numbers of 13 to 19 digits, with
+// optional spaces or dashes, for WithRedactPatterns
+const CardNumberPattern = `\b(?:\d[ -]?){12,18}\d\b`
+
+// headers that are always redacted
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+type redactor struct {
+	headers  map[string]bool
+	paths    []string
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+	keys     map[string]bool
+}
+
+func newRedactor() *redactor {
+	r := &redactor{headers: map[string]bool{}, fields: map[string]bool{}, keys: map[string]bool{}}
+	for _, name := range defaultRedactHeaders {
+		r.headers[name] = true
+	}
+	return r
+}
+
+// redact masks the params before the formatter and the writer functions see them
+func (r *redactor) redact(c *gin.Context, param *LogFormatterParams) {
+	param.RequestHeader = r.header(param.RequestHeader)
+	param.ResponseHeader = r.header(param.ResponseHeader)
+	param.Path = r.path(param.Path)
+	param.Keys = r.contextKeys(param.Keys)
+	param.RequestData = r.body(param.RequestData, c.ContentType(), param.RequestTruncated)
+	param.ResponseData = r.body(param.ResponseData, contentType(c.Writer.Header().Get("Content-Type")), param.ResponseTruncated)
+	for _, pattern := range r.patterns {
+		param.ErrorMessage = pattern.ReplaceAllString(param.ErrorMessage, Redacted)
+	}
+}
+
+// path masks the form fields of the query string and the patterns of a path
+func (r *redactor) path(path string) string {
+	if i := strings.IndexByte(path, '?'); i >= 0 && len(r.fields) > 0 {
+		path = path[:i+1] + r.form(path[i+1:])
+	}
+	for _, pattern := range r.patterns {
+		path = pattern.ReplaceAllString(path, Redacted)
+	}
+	return path
+}
+
+// contextKeys returns the keys of WithLogKeys only, the context holds
+// credentials such as the JWT_TOKEN and JWT_PAYLOAD of the jwt middleware
+func (r *redactor) contextKeys(keys map[string]interface{}) map[string]interface{} {
+	if len(r.keys) == 0 || len(keys) == 0 {
+		return nil
+	}
+	allowed := map[string]interface{}{}
+	for k, v := range keys {
+		if !r.keys[k] {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			for _, pattern := range r.patterns {
+				s = pattern.ReplaceAllString(s, Redacted)
+			}
+			v = s
+		}
+		allowed[k] = v
+	}
+	return allowed
+}
+
+// header returns a copy of h with the values of sensitive headers masked
+func (r *redactor) header(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	masked := make(http.Header, len(h))
+	for name, values := range h {
+		if r.headers[name] {
+			masked[name] = []string{Redacted}
+			continue
+		}
+		masked[name] = append([]string(nil), values...)
+	}
+	return masked
+}
+
+func (r *redactor) body(data string, contentType string, truncated bool) string {
+	if data == "" {
+		return data
+	}
+	switch {
+	case len(r.paths) > 0 && truncated && isJSON(data, contentType) && !gjson.Valid(data):
+		// a cut JSON body can't be parsed, so its paths can't be masked
+		return Redacted
+	case len(r.paths) > 0 && gjson.Valid(data):
+		data = r.json(data)
+	case len(r.fields) > 0 && contentType == gin.MIMEPOSTForm:
+		data = r.form(data)
+	}
+	for _, pattern := range r.patterns {
+		data = pattern.ReplaceAllString(data, Redacted)
+	}
+	return data
+}
+
+// json masks the values at the gjson paths, a path matching several values
+// such as users.#.password masks all of them
+func (r *redactor) json(data string) string {
+	for _, path := range r.paths {
+		result := gjson.Get(data, path)
+		if !result.Exists() {
+			continue
+		}
+		paths := result.Paths(data)
+		if len(paths) == 0 {
+			if p := result.Path(data); p != "" && p != "@this" {
+				paths = []string{p}
+			} else {
+				paths = []string{path}
+			}
+		}
+		for _, p := range paths {
+			if masked, err := sjson.Set(data, p, Redacted); err == nil {
+				data = masked
+			}
+		}
+	}
+	return data
+}
+
+// form masks the fields of a query string or urlencoded body, keeping the
+// order and encoding of the others
+func (r *redactor) form(data string) string {
+	pairs := strings.Split(data, "&")
+	for i, pair := range pairs {
+		key, _, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if name, err := url.QueryUnescape(key); err == nil && r.fields[name] {
+			pairs[i] = key + "=" + url.QueryEscape(Redacted)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func isJSON(data string, contentType string) bool {
+	if strings.HasSuffix(contentType, "json") {
+		return true
+	}
+	data = strings.TrimSpace(data)
+	return strings.HasPrefix(data, "{") || strings.HasPrefix(data, "[")
+}
+
+func contentType(header string) string {
+	return strings.TrimSpace(strings.SplitN(header, ";", 2)[0])
+}
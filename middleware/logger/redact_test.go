@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/donetkit/contrib-log/glog"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactJSONAndPatterns(t *testing.T) {
+	r := newRedactor()
+	WithRedactJSONPaths("password", "users.#.token", "card.number")(&config{redactor: r})
+	WithRedactPatterns(CardNumberPattern)(&config{redactor: r})
+
+	data := r.body(`{"name":"gin","password":"secret","users":[{"token":"a"},{"token":"b"}],"note":"card 4111 1111 1111 1111"}`, gin.MIMEJSON, false)
+	assert.NotContains(t, data, "secret")
+	assert.NotContains(t, data, `"a"`)
+	assert.NotContains(t, data, "4111")
+	assert.Contains(t, data, `"name":"gin"`)
+	assert.Equal(t, 4, strings.Count(data, Redacted))
+
+	assert.Equal(t, "not json", r.body("not json", gin.MIMEJSON, false))
+}
+
+func TestRedactForm(t *testing.T) {
+	r := newRedactor()
+	WithRedactFormFields("password", "access_token")(&config{redactor: r})
+
+	assert.Equal(t, "user=gin&password=%5BREDACTED%5D&keep=1", r.body("user=gin&password=secret&keep=1", gin.MIMEPOSTForm, false))
+	assert.Equal(t, "password=secret", r.body("password=secret", gin.MIMEPlain, false))
+	assert.Equal(t, "access_token=%5BREDACTED%5D&flag", r.form("access_token=abc&flag"))
+}
+
+func TestRedactKeys(t *testing.T) {
+	keys := map[string]interface{}{"JWT_TOKEN": "eyJhbGciOi", "JWT_PAYLOAD": map[string]interface{}{"id": 1}, "tenant": "acme 4111 1111 1111 1111"}
+	r := newRedactor()
+	assert.Nil(t, r.contextKeys(keys))
+
+	WithLogKeys("tenant")(&config{redactor: r})
+	WithRedactPatterns(CardNumberPattern)(&config{redactor: r})
+	assert.Equal(t, map[string]interface{}{"tenant": "acme " + Redacted}, r.contextKeys(keys))
+
+	fields := JSONFields(LogFormatterParams{Keys: r.contextKeys(keys)})
+	assert.NotContains(t, fields["keys"], "JWT_TOKEN")
+}
+
+func TestRedactParams(t *testing.T) {
+	logs := glog.New()
+	var logged *LogFormatterParams
+	r := gin.New()
+	r.Use(New(
+		WithLogger(logs),
+		WithRedactHeaders("X-Api-Key"),
+		WithRedactJSONPaths("password", "token"),
+		WithRedactFormFields("token"),
+		WithWriterLogFn(func(c *gin.Context, log *LogFormatterParams) {
+			logged = log
+		}),
+	))
+	r.POST("/login", func(c *gin.Context) {
+		_, _ = c.GetRawData()
+		c.Header("Set-Cookie", "session=secret")
+		c.JSON(http.StatusOK, gin.H{"token": "secret"})
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/login?token=secret&page=1", strings.NewReader(`{"user":"gin","password":"secret"}`))
+	req.Header.Set("Content-Type", gin.MIMEJSON)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "secret")
+	r.ServeHTTP(w, req)
+
+	if !assert.NotNil(t, logged) {
+		return
+	}
+	assert.Equal(t, "/login?token=%5BREDACTED%5D&page=1", logged.Path)
+	assert.Equal(t, `{"user":"gin","password":"[REDACTED]"}`, logged.RequestData)
+	assert.Equal(t, `{"token":"[REDACTED]"}`, logged.ResponseData)
+	assert.Equal(t, Redacted, logged.RequestHeader.Get("Authorization"))
+	assert.Equal(t, Redacted, logged.RequestHeader.Get("X-Api-Key"))
+	assert.Equal(t, Redacted, logged.ResponseHeader.Get("Set-Cookie"))
+	assert.Equal(t, gin.MIMEJSON, logged.RequestHeader.Get("Content-Type"))
+	// the request itself is untouched
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+}
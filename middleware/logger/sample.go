@@ -0,0 +1,113 @@
+package logger
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/donetkit/contrib-log/glog"
+	"github.com/gin-gonic/gin"
+)
+
+// sampler decides which access lines are written
+type sampler struct {
+	every   uint64
+	slow    time.Duration
+	counter uint64
+	bucket  *tokenBucket
+}
+
+// sample always keeps errors and slow requests and one in every other requests
+func (s *sampler) sample(c *gin.Context, param *LogFormatterParams) bool {
+	if s.every <= 1 {
+		return true
+	}
+	if param.StatusCode >= http.StatusBadRequest || len(c.Errors) > 0 {
+		return true
+	}
+	if s.slow > 0 && param.Latency >= s.slow {
+		return true
+	}
+	return atomic.AddUint64(&s.counter, 1)%s.every == 1
+}
+
+// tokenBucket allows rate lines per second with bursts of rate lines,
+// counting the lines dropped in between
+type tokenBucket struct {
+	mu      sync.Mutex
+	rate    float64
+	tokens  float64
+	last    time.Time
+	dropped uint64
+}
+
+func newTokenBucket(rate int) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// allow takes a token, it returns the lines dropped since the last allowed one
+func (b *tokenBucket) allow() (bool, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	if b.tokens < 1 {
+		b.dropped++
+		return false, 0
+	}
+	b.tokens--
+	dropped := b.dropped
+	b.dropped = 0
+	return true, dropped
+}
+
+// route overrides the level and body capture of a route template
+type route struct {
+	level  glog.Level
+	bodies bool
+}
+
+// routeOf returns the level of the access line and whether bodies are captured
+func (cfg *config) routeOf(c *gin.Context) (glog.Level, bool) {
+	if r, ok := cfg.routes[c.FullPath()]; ok {
+		return r.level, r.bodies
+	}
+	return glog.InfoLevel, true
+}
+
+// admit applies the sampling policy and the rate limit to an access line,
+// writing a summary of the lines the rate limit dropped before it
+func (cfg *config) admit(c *gin.Context, param *LogFormatterParams) bool {
+	if cfg.sampler != nil && !cfg.sampler.sample(c, param) {
+		return false
+	}
+	if cfg.sampler == nil || cfg.sampler.bucket == nil {
+		return true
+	}
+	ok, dropped := cfg.sampler.bucket.allow()
+	if ok && dropped > 0 && cfg.logger != nil {
+		cfg.logger.Warningf("dropped %d lines", dropped)
+	}
+	return ok
+}
+
+// logAt writes msg at level, Panic and Fatal are lowered to Error
+func logAt(logger glog.ILoggerEntry, level glog.Level, msg string) {
+	switch level {
+	case glog.TraceLevel:
+		logger.Trace(msg)
+	case glog.DebugLevel:
+		logger.Debug(msg)
+	case glog.InfoLevel:
+		logger.Info(msg)
+	case glog.WarnLevel:
+		logger.Warning(msg)
+	default:
+		logger.Error(msg)
+	}
+}
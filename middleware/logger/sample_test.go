@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib-log/glog"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type captureHook struct {
+	mu      sync.Mutex
+	entries []*logrus.Entry
+}
+
+func (h *captureHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *captureHook) Fire(e *logrus.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, e)
+	return nil
+}
+
+func (h *captureHook) count(level logrus.Level) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, e := range h.entries {
+		if e.Level == level {
+			n++
+		}
+	}
+	return n
+}
+
+func newCapturedRouter(opts ...Option) (*gin.Engine, *captureHook) {
+	logs := glog.New()
+	hook := &captureHook{}
+	logs.AddHook(hook)
+	r := gin.New()
+	r.Use(New(append([]Option{WithLogger(logs)}, opts...)...))
+	r.GET("/ok", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/fail", func(c *gin.Context) {
+		c.String(http.StatusInternalServerError, "fail")
+	})
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(5 * time.Millisecond)
+		c.String(http.StatusOK, "slow")
+	})
+	r.GET("/health", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return r, hook
+}
+
+func serve(r *gin.Engine, path string) {
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+func TestSampling(t *testing.T) {
+	r, hook := newCapturedRouter(WithSampling(10, time.Millisecond))
+	for i := 0; i < 20; i++ {
+		serve(r, "/ok")
+	}
+	assert.Equal(t, 2, hook.count(logrus.InfoLevel))
+
+	serve(r, "/fail")
+	serve(r, "/slow")
+	assert.Equal(t, 4, hook.count(logrus.InfoLevel))
+}
+
+func TestRateLimit(t *testing.T) {
+	r, hook := newCapturedRouter(WithRateLimit(2))
+	for i := 0; i < 5; i++ {
+		serve(r, "/ok")
+	}
+	assert.Equal(t, 2, hook.count(logrus.InfoLevel))
+
+	time.Sleep(600 * time.Millisecond)
+	serve(r, "/ok")
+	assert.Equal(t, 3, hook.count(logrus.InfoLevel))
+	if assert.Equal(t, 1, hook.count(logrus.WarnLevel)) {
+		for _, e := range hook.entries {
+			if e.Level == logrus.WarnLevel {
+				assert.Equal(t, "dropped 3 lines", e.Message)
+			}
+		}
+	}
+}
+
+func TestRouteOverrides(t *testing.T) {
+	r, hook := newCapturedRouter(WithRouteLevel("/health", glog.DebugLevel), WithRouteBodies("/health", false))
+	serve(r, "/health")
+	assert.Equal(t, 0, hook.count(logrus.InfoLevel))
+	assert.Equal(t, 1, hook.count(logrus.DebugLevel))
+
+	serve(r, "/ok")
+	assert.Equal(t, 1, hook.count(logrus.InfoLevel))
+	assert.Equal(t, 3, hook.count(logrus.DebugLevel))
+}
@@ -0,0 +1,489 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Overflow is what a FileSink does with a line when its buffer is full
+type Overflow int
+
+const (
+	// OverflowDrop overwrites the oldest buffered line, requests never wait
+	OverflowDrop Overflow = iota
+	// OverflowBlock makes the request wait for room, no line is lost
+	OverflowBlock
+)
+
+const (
+	defaultSinkBufferSize = 4096
+	defaultSinkMaxSize    = 100 << 20
+	defaultSinkSync       = time.Second
+
+	// backups are named after the file plus the time they were rotated at,
+	// the layout sorts by name in time order
+	backupTimeFormat = "20060102T150405.000"
+	compressSuffix   = ".gz"
+)
+
+// ErrSinkClosed is returned by the writes to a closed FileSink
+var ErrSinkClosed = errors.New("logger: file sink closed")
+
+// SinkOption for NewFileSink
+type SinkOption func(*FileSink)
+
+// WithBufferSize set how many lines are buffered before the overflow policy
+// kicks in (default 4096)
+func WithBufferSize(lines int) SinkOption {
+	return func(s *FileSink) {
+		if lines > 0 {
+			s.ring = make([][]byte, lines)
+		}
+	}
+}
+
+// WithOverflow set the policy of a full buffer (default OverflowDrop)
+func WithOverflow(policy Overflow) SinkOption {
+	return func(s *FileSink) {
+		s.overflow = policy
+	}
+}
+
+// WithMaxSize rotate the file before it grows past size bytes (default
+// 100MB), 0 disables size based rotation
+func WithMaxSize(size int64) SinkOption {
+	return func(s *FileSink) {
+		s.maxSize = size
+	}
+}
+
+// WithRotateEvery rotate the file every interval, such as 24 * time.Hour,
+// aligned on multiples of the interval since the zero time
+func WithRotateEvery(interval time.Duration) SinkOption {
+	return func(s *FileSink) {
+		s.every = interval
+	}
+}
+
+// WithCompress gzip the rotated files
+func WithCompress(compress bool) SinkOption {
+	return func(s *FileSink) {
+		s.compress = compress
+	}
+}
+
+// WithMaxBackups keep only the newest count rotated files, 0 keeps them all
+func WithMaxBackups(count int) SinkOption {
+	return func(s *FileSink) {
+		s.maxBackups = count
+	}
+}
+
+// WithSyncInterval fsync the file at most once per interval (default 1s),
+// 0 fsyncs after every batch of lines and a negative interval leaves it to
+// the operating system
+func WithSyncInterval(interval time.Duration) SinkOption {
+	return func(s *FileSink) {
+		s.syncEvery = interval
+	}
+}
+
+// FileSink appends lines to a local file from a background goroutine.
+// Writes go to a bounded ring buffer, a full buffer drops the oldest line or
+// blocks as set by WithOverflow. The file is rotated by size and by time,
+// rotated files are optionally gzipped and pruned. WriteSync writes on the
+// caller's goroutine instead.
+type FileSink struct {
+	path       string
+	overflow   Overflow
+	maxSize    int64
+	every      time.Duration
+	compress   bool
+	maxBackups int
+	syncEvery  time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	space   *sync.Cond
+	ring    [][]byte
+	head    int
+	count   int
+	dropped uint64
+	closed  bool
+	notify  chan struct{}
+	err     error
+
+	// fileMu guards the file, held by run and by WriteSync
+	fileMu   sync.Mutex
+	shut     bool
+	file     *os.File
+	w        *bufio.Writer
+	size     int64
+	rotateAt time.Time
+	syncedAt time.Time
+	dirty    bool
+
+	mill     chan struct{}
+	done     chan struct{}
+	millDone chan struct{}
+}
+
+// NewFileSink opens or creates the file at path and starts writing to it,
+// Close flushes the buffered lines and stops the sink
+func NewFileSink(path string, opts ...SinkOption) (*FileSink, error) {
+	s := &FileSink{
+		path:      path,
+		maxSize:   defaultSinkMaxSize,
+		syncEvery: defaultSinkSync,
+		now:       time.Now,
+		ring:      make([][]byte, defaultSinkBufferSize),
+		notify:    make(chan struct{}, 1),
+		mill:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		millDone:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.space = sync.NewCond(&s.mu)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	go s.run()
+	go s.runMill()
+	return s, nil
+}
+
+// Write queues a copy of p, it only fails once the sink is closed
+func (s *FileSink) Write(p []byte) (int, error) {
+	line := append([]byte(nil), p...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.closed && s.count == len(s.ring) && s.overflow == OverflowBlock {
+		s.space.Wait()
+	}
+	if s.closed {
+		return 0, ErrSinkClosed
+	}
+	if s.count == len(s.ring) {
+		s.ring[s.head] = nil
+		s.head = (s.head + 1) % len(s.ring)
+		s.count--
+		s.dropped++
+	}
+	s.ring[(s.head+s.count)%len(s.ring)] = line
+	s.count++
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// WriteSync writes the buffered lines and p to the file and fsyncs it before
+// returning, whatever the overflow policy and sync interval, for lines such as
+// audit records that must survive a crash
+func (s *FileSink) WriteSync(p []byte) (int, error) {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if s.shut {
+		return 0, ErrSinkClosed
+	}
+	for _, line := range s.take(nil) {
+		s.write(line)
+	}
+	if s.due(len(p)) {
+		s.rotate()
+	}
+	n, err := s.w.Write(p)
+	s.size += int64(n)
+	if err == nil {
+		err = s.w.Flush()
+	}
+	if err == nil {
+		err = s.file.Sync()
+		s.syncedAt = s.now()
+		s.dirty = false
+	}
+	s.setErr(err)
+	return n, err
+}
+
+// Dropped returns how many lines OverflowDrop overwrote so far
+func (s *FileSink) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close writes the buffered lines, fsyncs and closes the file, and waits
+// for the rotated files to be compressed and pruned. It returns the first
+// error the sink ran into.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.millDone
+		return nil
+	}
+	s.closed = true
+	close(s.notify)
+	s.space.Broadcast()
+	s.mu.Unlock()
+
+	<-s.done
+	close(s.mill)
+	<-s.millDone
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *FileSink) run() {
+	defer close(s.done)
+	tick := time.NewTicker(time.Second)
+	if s.syncEvery > 0 && s.syncEvery < time.Second {
+		tick.Reset(s.syncEvery)
+	}
+	defer tick.Stop()
+
+	var batch [][]byte
+	for {
+		select {
+		case _, ok := <-s.notify:
+			s.fileMu.Lock()
+			batch = s.take(batch[:0])
+			for _, line := range batch {
+				s.write(line)
+			}
+			s.flush(s.syncEvery == 0)
+			if !ok {
+				s.flush(s.syncEvery >= 0)
+				s.setErr(s.file.Close())
+				s.shut = true
+				s.fileMu.Unlock()
+				return
+			}
+			s.fileMu.Unlock()
+		case <-tick.C:
+			s.fileMu.Lock()
+			if s.due(0) {
+				s.rotate()
+			}
+			s.flush(false)
+			s.fileMu.Unlock()
+		}
+	}
+}
+
+// take moves the buffered lines to batch
+func (s *FileSink) take(batch [][]byte) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.count > 0 {
+		batch = append(batch, s.ring[s.head])
+		s.ring[s.head] = nil
+		s.head = (s.head + 1) % len(s.ring)
+		s.count--
+	}
+	s.space.Broadcast()
+	return batch
+}
+
+func (s *FileSink) write(line []byte) {
+	if s.due(len(line)) {
+		s.rotate()
+	}
+	n, err := s.w.Write(line)
+	s.size += int64(n)
+	s.dirty = true
+	s.setErr(err)
+}
+
+// due reports whether the file must be rotated before n more bytes
+func (s *FileSink) due(n int) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.maxSize > 0 && s.size+int64(n) > s.maxSize {
+		return true
+	}
+	return s.every > 0 && !s.now().Before(s.rotateAt)
+}
+
+// flush hands the buffered bytes to the OS, and fsyncs them when force is
+// set or the sync interval passed
+func (s *FileSink) flush(force bool) {
+	s.setErr(s.w.Flush())
+	if !s.dirty || s.syncEvery < 0 {
+		return
+	}
+	if now := s.now(); force || s.syncEvery > 0 && now.Sub(s.syncedAt) >= s.syncEvery {
+		s.setErr(s.file.Sync())
+		s.syncedAt = now
+		s.dirty = false
+	}
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	now := s.now()
+	s.file = f
+	s.w = bufio.NewWriter(f)
+	s.size = info.Size()
+	s.syncedAt = now
+	if s.every > 0 {
+		s.rotateAt = now.Truncate(s.every).Add(s.every)
+	}
+	return nil
+}
+
+// rotate renames the file to a backup and opens a new one, a failed
+// rotation keeps appending to the current file
+func (s *FileSink) rotate() {
+	s.flush(s.syncEvery >= 0)
+	if err := s.file.Close(); err != nil {
+		s.setErr(err)
+	}
+	if err := os.Rename(s.path, s.backupName(s.now())); err != nil {
+		s.setErr(err)
+	}
+	if err := s.open(); err != nil {
+		// nothing left to write to, the lines are lost until Close
+		// reports the error
+		s.setErr(err)
+		s.file, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		s.w = bufio.NewWriter(s.file)
+		return
+	}
+	select {
+	case s.mill <- struct{}{}:
+	default:
+	}
+}
+
+func (s *FileSink) backupName(t time.Time) string {
+	ext := filepath.Ext(s.path)
+	prefix := strings.TrimSuffix(s.path, ext)
+	return prefix + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// runMill compresses and prunes the backups after each rotation
+func (s *FileSink) runMill() {
+	defer close(s.millDone)
+	for range s.mill {
+		s.setErr(s.millBackups())
+	}
+}
+
+func (s *FileSink) millBackups() error {
+	backups, err := s.backups()
+	if err != nil {
+		return err
+	}
+	if s.compress {
+		for i, name := range backups {
+			if strings.HasSuffix(name, compressSuffix) {
+				continue
+			}
+			if err := compressFile(name); err != nil {
+				return err
+			}
+			backups[i] = name + compressSuffix
+		}
+	}
+	if s.maxBackups > 0 && len(backups) > s.maxBackups {
+		for _, name := range backups[:len(backups)-s.maxBackups] {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backups returns the rotated files of the sink, oldest first
+func (s *FileSink) backups() ([]string, error) {
+	ext := filepath.Ext(s.path)
+	prefix := strings.TrimSuffix(filepath.Base(s.path), ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(s.path))
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, compressSuffix), ext)
+		if entry.IsDir() || !strings.HasPrefix(stamp, prefix) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, stamp[len(prefix):]); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(s.path), name))
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], compressSuffix) < strings.TrimSuffix(backups[j], compressSuffix)
+	})
+	return backups, nil
+}
+
+// compressFile gzips name to name.gz and removes name once the copy is on disk
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+compressSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if serr := dst.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(name + compressSuffix)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// setErr keeps the first error, run and the mill both report to it
+func (s *FileSink) setErr(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
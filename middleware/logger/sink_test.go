@@ -0,0 +1,190 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib-gin/middleware/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func readLines(t *testing.T, name string) []string {
+	f, err := os.Open(name)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(name, compressSuffix) {
+		zr, err := gzip.NewReader(f)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		r = zr
+	}
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+	sink, err := NewFileSink(name, WithMaxSize(100), WithCompress(true), WithMaxBackups(2), WithSyncInterval(0))
+	if !assert.NoError(t, err) {
+		return
+	}
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 10; i++ {
+		_, err = sink.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, sink.Close())
+	_, err = sink.Write([]byte(line))
+	assert.Equal(t, ErrSinkClosed, err)
+
+	backups, err := sink.backups()
+	assert.NoError(t, err)
+	if assert.Len(t, backups, 2) {
+		for _, backup := range backups {
+			assert.True(t, strings.HasSuffix(backup, ".log"+compressSuffix), backup)
+			assert.Len(t, readLines(t, backup), 2)
+		}
+	}
+	assert.Len(t, readLines(t, name), 2)
+}
+
+func TestFileSinkRotateEvery(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+	sink, err := NewFileSink(name, WithRotateEvery(50*time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, _ = sink.Write([]byte("first\n"))
+	time.Sleep(120 * time.Millisecond)
+	_, _ = sink.Write([]byte("second\n"))
+	assert.NoError(t, sink.Close())
+
+	backups, _ := sink.backups()
+	if assert.Len(t, backups, 1) {
+		assert.Equal(t, []string{"first"}, readLines(t, backups[0]))
+	}
+	assert.Equal(t, []string{"second"}, readLines(t, name))
+}
+
+func newRing(size int, overflow Overflow) *FileSink {
+	s := &FileSink{ring: make([][]byte, size), overflow: overflow, notify: make(chan struct{}, 1)}
+	s.space = sync.NewCond(&s.mu)
+	return s
+}
+
+func TestFileSinkOverflowDrop(t *testing.T) {
+	s := newRing(2, OverflowDrop)
+	for _, line := range []string{"a", "b", "c"} {
+		_, err := s.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, uint64(1), s.Dropped())
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c")}, s.take(nil))
+}
+
+func TestFileSinkOverflowBlock(t *testing.T) {
+	s := newRing(1, OverflowBlock)
+	_, _ = s.Write([]byte("a"))
+	written := make(chan struct{})
+	go func() {
+		_, _ = s.Write([]byte("b"))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("write did not wait for room")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.Equal(t, [][]byte{[]byte("a")}, s.take(nil))
+	<-written
+	assert.Equal(t, [][]byte{[]byte("b")}, s.take(nil))
+	assert.Equal(t, uint64(0), s.Dropped())
+}
+
+func TestFileSinkWriteSync(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(name, WithSyncInterval(time.Hour))
+	assert.NoError(t, err)
+	_, err = sink.Write([]byte("a\n"))
+	assert.NoError(t, err)
+	n, err := sink.WriteSync([]byte("b\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	// the queued line is written first
+	assert.Equal(t, []string{"a", "b"}, readLines(t, name))
+
+	assert.NoError(t, sink.Close())
+	_, err = sink.WriteSync([]byte("c\n"))
+	assert.Equal(t, ErrSinkClosed, err)
+}
+
+func TestFileSinkAndAudit(t *testing.T) {
+	dir := t.TempDir()
+	access, err := NewFileSink(filepath.Join(dir, "access.log"))
+	assert.NoError(t, err)
+	audit, err := NewFileSink(filepath.Join(dir, "audit.log"), WithSyncInterval(time.Hour))
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(New(
+		WithFileSink(access, nil),
+		WithAudit(audit, "", "role"),
+		WithRedactFormFields("token"),
+		WithSampling(1000, 0),
+	))
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Set("JWT_PAYLOAD", jwt.MapClaims{jwt.IdentityKey: user, "role": "admin", "email": "alice@example.com"})
+		}
+	})
+	r.GET("/orders/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/1?token=secret", nil)
+	req.Header.Set("X-User", "alice")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/2", nil))
+	// the audit line is on disk before the request returns
+	assert.Len(t, readLines(t, filepath.Join(dir, "audit.log")), 1)
+	assert.NoError(t, access.Close())
+	assert.NoError(t, audit.Close())
+
+	// sampling keeps the first line only, the audit sees every identity
+	lines := readLines(t, filepath.Join(dir, "access.log"))
+	if assert.Len(t, lines, 1) {
+		var fields map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &fields))
+		assert.Equal(t, "/orders/1?token=%5BREDACTED%5D", fields["path"])
+	}
+
+	lines = readLines(t, filepath.Join(dir, "audit.log"))
+	if assert.Len(t, lines, 1) {
+		var rec AuditRecord
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+		assert.Equal(t, "alice", rec.Identity)
+		assert.Equal(t, map[string]interface{}{"role": "admin"}, rec.Claims)
+		assert.Equal(t, "/orders/:id", rec.Route)
+		assert.Equal(t, "/orders/1?token=%5BREDACTED%5D", rec.Path)
+		assert.Equal(t, http.StatusOK, rec.Status)
+	}
+}
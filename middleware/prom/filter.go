@@ -8,11 +8,19 @@ const defaultSize = 2 << 24
 
 var seeds = []uint{7, 11, 13, 31, 37, 61}
 
+// BloomFilter is the set the unique visitors were counted with.
+//
+// Deprecated: the unique visitors are estimated with hll.Estimator of
+// github.com/donetkit/contrib-gin/pkg/hll, which counts over rolling windows
+// and merges across replicas.
 type BloomFilter struct {
 	Set   *bitset.BitSet
 	Funks [6]simpleHash
 }
 
+// NewBloomFilter returns an empty BloomFilter.
+//
+// Deprecated: use hll.NewEstimator.
 func NewBloomFilter() *BloomFilter {
 	bf := new(BloomFilter)
 	for i := 0; i < len(bf.Funks); i++ {
@@ -0,0 +1,69 @@
+package prom
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// UnmatchedRoute is the endpoint label of requests no route matched
+	UnmatchedRoute = "unmatched"
+	// OtherLabel is the endpoint label of the series past the series limit
+	OtherLabel = "other"
+
+	defaultSeriesLimit = 1000
+	endpointLabelIndex = 1
+)
+
+// routeLabel returns the route template of the request, such as /users/:id
+func routeLabel(c *gin.Context) string {
+	if path := c.FullPath(); path != "" {
+		return path
+	}
+	return UnmatchedRoute
+}
+
+// seriesLimiter lets the first limit label sets of a metric through and
+// collapses the endpoint of the others into OtherLabel
+type seriesLimiter struct {
+	limit     int
+	mu        sync.RWMutex
+	seen      map[string]struct{}
+	collapsed prometheus.Counter
+}
+
+func newSeriesLimiter(limit int, collapsed prometheus.Counter) *seriesLimiter {
+	return &seriesLimiter{limit: limit, seen: map[string]struct{}{}, collapsed: collapsed}
+}
+
+// labels returns lvs, or a copy with the endpoint collapsed once the budget
+// of the metric is spent
+func (l *seriesLimiter) labels(lvs []string) []string {
+	if l.limit <= 0 {
+		return lvs
+	}
+	key := strings.Join(lvs, "\xff")
+	l.mu.RLock()
+	_, ok := l.seen[key]
+	full := len(l.seen) >= l.limit
+	l.mu.RUnlock()
+	if ok {
+		return lvs
+	}
+	if !full {
+		l.mu.Lock()
+		if _, ok = l.seen[key]; ok || len(l.seen) < l.limit {
+			l.seen[key] = struct{}{}
+			l.mu.Unlock()
+			return lvs
+		}
+		l.mu.Unlock()
+	}
+	l.collapsed.Inc()
+	collapsed := append([]string(nil), lvs...)
+	collapsed[endpointLabelIndex] = OtherLabel
+	return collapsed
+}
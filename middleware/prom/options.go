@@ -1,8 +1,10 @@
 package prom
 
 import (
+	"github.com/donetkit/contrib-gin/pkg/hll"
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
 )
 
 // Config defines the config for logger middleware
@@ -16,6 +18,16 @@ type config struct {
 	excludeRegexEndpoint   []string
 	excludeRegexMethod     []string
 	endpointLabelMappingFn RequestLabelMappingFn
+	collectors             []prometheus.Collector
+	registerer             prometheus.Registerer
+	gatherer               prometheus.Gatherer
+	router                 *gin.Engine
+	seriesLimit            int
+	visitors               *hll.Estimator
+	queueHeader            string
+	queueDuration          []float64
+	slos                   []SLO
+	burnRateWindows        []time.Duration
 }
 
 // Option for queue system
@@ -63,19 +75,40 @@ func WithExcludeRegexMethod(excludeRegexMethod []string) Option {
 	}
 }
 
-// WithEndpointLabelMappingFn set endpointLabelMappingFn function
+// WithEndpointLabelMappingFn set endpointLabelMappingFn function, the default
+// labels the route template, such as /users/:id, and UnmatchedRoute for 404s
 func WithEndpointLabelMappingFn(endpointLabelMappingFn RequestLabelMappingFn) Option {
 	return func(cfg *config) {
 		cfg.endpointLabelMappingFn = endpointLabelMappingFn
 	}
 }
 
-// WithPromHandler set router function
+// WithPromHandler serve the gatherer of the metrics on router at handlerUrl.
+// Since the metrics have a registry of their own by default, the collectors
+// registered on prometheus.DefaultRegisterer are no longer served, use
+// WithRegistry(prometheus.DefaultRegisterer, prometheus.DefaultGatherer) to
+// serve them as before.
 func WithPromHandler(router *gin.Engine) Option {
 	return func(cfg *config) {
-		if router != nil {
-			router.GET(cfg.handlerUrl, promHandler(promhttp.Handler()))
+		cfg.router = router
+	}
+}
+
+// WithRegistry register the metrics on registerer and serve them from
+// gatherer, such as prometheus.DefaultRegisterer and prometheus.DefaultGatherer.
+// A nil gatherer uses the registerer when it is a prometheus.Registry, and
+// panics otherwise. By default every instance has a registry of its own with
+// the Go and process collectors.
+func WithRegistry(registerer prometheus.Registerer, gatherer prometheus.Gatherer) Option {
+	return func(cfg *config) {
+		if gatherer == nil {
+			gatherer, _ = registerer.(prometheus.Gatherer)
 		}
+		if gatherer == nil {
+			panic("prom: WithRegistry needs a gatherer for a registerer which is not a prometheus.Gatherer")
+		}
+		cfg.registerer = registerer
+		cfg.gatherer = gatherer
 	}
 }
 
@@ -92,3 +125,58 @@ func WithSlowTime(slowTime float64) Option {
 		cfg.slowTime = slowTime
 	}
 }
+
+// WithCollectors register additional collectors, such as cache.Metrics, next to the http metrics
+func WithCollectors(collectors ...prometheus.Collector) Option {
+	return func(cfg *config) {
+		cfg.collectors = append(cfg.collectors, collectors...)
+	}
+}
+
+// WithSeriesLimit set how many label sets each metric may have (default
+// 1000), the endpoint of the label sets past it is collapsed into OtherLabel.
+// 0 disables the limit.
+func WithSeriesLimit(limit int) Option {
+	return func(cfg *config) {
+		cfg.seriesLimit = limit
+	}
+}
+
+// WithUniqueVisitors count the client IPs with estimator, such as one shared
+// with the other replicas through hll.WithCache. By default the request_uv
+// gauge estimates the last hour and the last day of this instance.
+func WithUniqueVisitors(estimator *hll.Estimator) Option {
+	return func(cfg *config) {
+		cfg.visitors = estimator
+	}
+}
+
+// WithQueueTime set the header the proxy stamps the request start in (default
+// X-Request-Start) and the buckets of http_request_queue_seconds (default
+// 0.005 to 1). An empty header disables the queue time. The header must be
+// set by a trusted proxy which overwrites the one of the client, otherwise
+// clients pick the recorded queue time.
+func WithQueueTime(header string, duration []float64) Option {
+	return func(cfg *config) {
+		cfg.queueHeader = header
+		if len(duration) > 0 {
+			cfg.queueDuration = duration
+		}
+	}
+}
+
+// WithSLOs export the good and bad events of slos and their error budget
+// burn rates, routes are matched against the endpoint label
+func WithSLOs(slos ...SLO) Option {
+	return func(cfg *config) {
+		cfg.slos = append(cfg.slos, slos...)
+	}
+}
+
+// WithBurnRateWindows set the windows of http_slo_burn_rate (default
+// DefaultBurnRateWindows)
+func WithBurnRateWindows(windows ...time.Duration) Option {
+	return func(cfg *config) {
+		cfg.burnRateWindows = windows
+	}
+}
@@ -1,46 +1,83 @@
 package prom
 
 import (
+	"context"
 	"fmt"
+	"github.com/donetkit/contrib-gin/pkg/hll"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// traceIDLabel is the label of the exemplars
+const traceIDLabel = "trace_id"
+
 var (
 	labels = []string{"status", "endpoint", "method"}
 
 	labelsServeName = []string{"name"}
 
-	reqUVTotal *prometheus.CounterVec
-
-	slowReqTotal *prometheus.CounterVec
-
-	uptime *prometheus.CounterVec
-
-	reqCount *prometheus.CounterVec
-
-	reqDuration *prometheus.HistogramVec
+	// the endpoint comes second, as in labels, for the series limiter
+	labelsInFlight = []string{"method", "endpoint"}
 
-	reqSizeBytes *prometheus.SummaryVec
+	defaultQueueHeader   = "X-Request-Start"
+	defaultQueueDuration = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+)
 
+// Metrics are the HTTP metrics of one engine, registered on the registry of
+// WithRegistry or on a registry of their own
+type Metrics struct {
+	config     *config
+	registerer prometheus.Registerer
+	gatherer   prometheus.Gatherer
+	collectors []prometheus.Collector
+
+	visitors      *hll.Estimator
+	slowReqTotal  *prometheus.CounterVec
+	uptime        *prometheus.CounterVec
+	reqCount      *prometheus.CounterVec
+	reqDuration   *prometheus.HistogramVec
+	reqSizeBytes  *prometheus.SummaryVec
 	respSizeBytes *prometheus.SummaryVec
-)
+	reqInFlight   *prometheus.GaugeVec
+	reqQueue      prometheus.Histogram
+	slos          *sloTracker
+
+	seriesCollapsed *prometheus.CounterVec
+	slowLimiter     *seriesLimiter
+	countLimiter    *seriesLimiter
+	durationLimiter *seriesLimiter
+	reqSizeLimiter  *seriesLimiter
+	respSizeLimiter *seriesLimiter
+	inFlightLimiter *seriesLimiter
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
 
-// init registers the prometheus metrics
-func (c *config) registerPrometheusOpts() {
+// newMetrics creates the collectors of an instance
+func (c *config) newMetrics() *Metrics {
+	m := &Metrics{
+		config:     c,
+		registerer: c.registerer,
+		gatherer:   c.gatherer,
+		stop:       make(chan struct{}),
+	}
 
-	reqUVTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: c.namespace,
-			Name:      "request_uv_total",
-			Help:      "all the server received ip num.",
-		}, nil,
-	)
+	m.visitors = c.visitors
+	if m.visitors == nil {
+		m.visitors = hll.NewEstimator(hll.WithNamespace(c.namespace), hll.WithName("request_uv"))
+	}
 
-	slowReqTotal = prometheus.NewCounterVec(
+	m.slowReqTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: c.namespace,
 			Name:      "slow_request_total",
@@ -48,7 +85,7 @@ func (c *config) registerPrometheusOpts() {
 		}, labels,
 	)
 
-	uptime = prometheus.NewCounterVec(
+	m.uptime = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: c.namespace,
 			Name:      "uptime",
@@ -56,7 +93,7 @@ func (c *config) registerPrometheusOpts() {
 		}, labelsServeName,
 	)
 
-	reqCount = prometheus.NewCounterVec(
+	m.reqCount = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: c.namespace,
 			Name:      "http_request_count_total",
@@ -64,7 +101,7 @@ func (c *config) registerPrometheusOpts() {
 		}, labels,
 	)
 
-	reqDuration = prometheus.NewHistogramVec(
+	m.reqDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: c.namespace,
 			Name:      "http_request_duration_seconds",
@@ -73,7 +110,7 @@ func (c *config) registerPrometheusOpts() {
 		}, labels,
 	)
 
-	reqSizeBytes = prometheus.NewSummaryVec(
+	m.reqSizeBytes = prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Namespace: c.namespace,
 			Name:      "http_request_size_bytes",
@@ -81,24 +118,99 @@ func (c *config) registerPrometheusOpts() {
 		}, labels,
 	)
 
-	respSizeBytes = prometheus.NewSummaryVec(
+	m.respSizeBytes = prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Namespace: c.namespace,
 			Name:      "http_response_size_bytes",
 			Help:      "HTTP response sizes in bytes.",
 		}, labels,
 	)
-	prometheus.MustRegister(reqUVTotal, slowReqTotal, uptime, reqCount, reqDuration, reqSizeBytes, respSizeBytes)
-	go c.recordUptime()
+
+	m.reqInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: c.namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests being handled.",
+		}, labelsInFlight,
+	)
+
+	m.reqQueue = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: c.namespace,
+			Name:      "http_request_queue_seconds",
+			Help:      fmt.Sprintf("Time HTTP requests waited between the proxy and the server, from the %s header.", c.queueHeader),
+			Buckets:   c.queueDuration,
+		},
+	)
+
+	m.seriesCollapsed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: c.namespace,
+			Name:      "http_series_collapsed_total",
+			Help:      "Observations recorded under the other endpoint because the series limit of the metric was reached.",
+		}, []string{"metric"},
+	)
+	limiter := func(name string) *seriesLimiter {
+		return newSeriesLimiter(c.seriesLimit, m.seriesCollapsed.WithLabelValues(name))
+	}
+	m.slowLimiter = limiter("slow_request_total")
+	m.countLimiter = limiter("http_request_count_total")
+	m.durationLimiter = limiter("http_request_duration_seconds")
+	m.reqSizeLimiter = limiter("http_request_size_bytes")
+	m.respSizeLimiter = limiter("http_response_size_bytes")
+	m.inFlightLimiter = limiter("http_requests_in_flight")
+	m.collectors = []prometheus.Collector{m.visitors, m.slowReqTotal, m.uptime, m.reqCount, m.reqDuration, m.reqSizeBytes, m.respSizeBytes, m.reqInFlight, m.seriesCollapsed}
+	if c.queueHeader != "" {
+		m.collectors = append(m.collectors, m.reqQueue)
+	}
+	if len(c.slos) > 0 {
+		m.slos = newSLOTracker(c.namespace, c.slos, c.burnRateWindows)
+		m.collectors = append(m.collectors, m.slos)
+	}
+	m.collectors = append(m.collectors, c.collectors...)
+	return m
+}
+
+// register registers the collectors and starts the uptime ticker
+func (m *Metrics) register() {
+	m.registerer.MustRegister(m.collectors...)
+	go m.recordUptime()
 }
 
-// recordUptime increases service uptime per second.
-func (c *config) recordUptime() {
-	for range time.Tick(time.Second) {
-		uptime.WithLabelValues(c.name).Inc()
+// recordUptime increases service uptime per second until Close.
+func (m *Metrics) recordUptime() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.uptime.WithLabelValues(m.config.name).Inc()
+		case <-m.stop:
+			return
+		}
 	}
 }
 
+// Gatherer returns the gatherer the metrics are served from
+func (m *Metrics) Gatherer() prometheus.Gatherer {
+	return m.gatherer
+}
+
+// Close stops the uptime ticker and unregisters the collectors, so New may
+// register them again on the same registry. An estimator passed to
+// WithUniqueVisitors is left open.
+func (m *Metrics) Close() {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+		if m.config.visitors == nil {
+			m.visitors.Close()
+		}
+		for _, collector := range m.collectors {
+			m.registerer.Unregister(collector)
+		}
+	})
+}
+
 // calcRequestSize returns the size of request object.
 func calcRequestSize(r *http.Request) float64 {
 	size := 0
@@ -147,30 +259,68 @@ func (c *config) checkLabel(label string, patterns []string) bool {
 	return true
 }
 
-// New returns a gin.HandlerFunc for exporting some Web metrics
+// New returns a gin.HandlerFunc for exporting some Web metrics, use
+// NewMetrics to be able to Close them
 func New(opts ...Option) gin.HandlerFunc {
+	return NewMetrics(opts...).Handler()
+}
+
+// NewMetrics creates and registers the Web metrics of an engine
+func NewMetrics(opts ...Option) *Metrics {
 	cfg := &config{
-		slowTime:   1,
-		namespace:  "service",
-		name:       "service",
-		duration:   []float64{0.1, 0.3, 1.2, 5},
-		handlerUrl: "/metrics",
-		endpointLabelMappingFn: func(c *gin.Context) string {
-			return c.Request.URL.Path
-		},
+		slowTime:               1,
+		namespace:              "service",
+		name:                   "service",
+		duration:               []float64{0.1, 0.3, 1.2, 5},
+		handlerUrl:             "/metrics",
+		seriesLimit:            defaultSeriesLimit,
+		endpointLabelMappingFn: routeLabel,
+		queueHeader:            defaultQueueHeader,
+		queueDuration:          defaultQueueDuration,
+		burnRateWindows:        DefaultBurnRateWindows,
 	}
 	for _, opt := range opts {
 		opt(cfg)
 	}
-	cfg.registerPrometheusOpts()
-	bloomFilter := NewBloomFilter()
+	if cfg.registerer == nil {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		cfg.registerer, cfg.gatherer = registry, registry
+	}
+	m := cfg.newMetrics()
+	m.register()
+	if cfg.router != nil {
+		cfg.router.GET(cfg.handlerUrl, promHandler(promhttp.HandlerFor(m.gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	}
+	return m
+}
+
+// Handler returns the gin.HandlerFunc recording the metrics
+func (m *Metrics) Handler() gin.HandlerFunc {
+	cfg := m.config
 	return func(c *gin.Context) {
 		start := time.Now()
+		endpoint := cfg.endpointLabelMappingFn(c)
+		method := c.Request.Method
+
+		if cfg.queueHeader != "" {
+			if wait, ok := queueTime(c.GetHeader(cfg.queueHeader), start); ok {
+				m.reqQueue.Observe(wait.Seconds())
+			}
+		}
+
+		if cfg.checkLabel(endpoint, cfg.excludeRegexEndpoint) && cfg.checkLabel(method, cfg.excludeRegexMethod) {
+			inFlight := m.reqInFlight.WithLabelValues(m.inFlightLimiter.labels([]string{method, endpoint})...)
+			inFlight.Inc()
+			defer inFlight.Dec()
+		}
+
 		c.Next()
 
 		status := fmt.Sprintf("%d", c.Writer.Status())
-		endpoint := cfg.endpointLabelMappingFn(c)
-		method := c.Request.Method
 
 		lvs := []string{status, endpoint, method}
 
@@ -186,24 +336,65 @@ func New(opts ...Option) gin.HandlerFunc {
 		}
 
 		// set uv
-		if clientIP := c.ClientIP(); !bloomFilter.Contains(clientIP) {
-			bloomFilter.Add(clientIP)
-			reqUVTotal.WithLabelValues().Inc()
-		}
+		m.visitors.Add(c.ClientIP())
+
+		elapsed := time.Since(start)
+		second := elapsed.Seconds()
 
-		second := time.Since(start).Seconds()
-		
 		// set slow request
 		if second > cfg.slowTime {
-			slowReqTotal.WithLabelValues(lvs...).Inc()
+			m.slowReqTotal.WithLabelValues(m.slowLimiter.labels(lvs)...).Inc()
+		}
+		m.reqCount.WithLabelValues(m.countLimiter.labels(lvs)...).Inc()
+		observe(c.Request.Context(), m.reqDuration.WithLabelValues(m.durationLimiter.labels(lvs)...), second)
+		m.reqSizeBytes.WithLabelValues(m.reqSizeLimiter.labels(lvs)...).Observe(calcRequestSize(c.Request))
+		m.respSizeBytes.WithLabelValues(m.respSizeLimiter.labels(lvs)...).Observe(float64(respSize))
+		if m.slos != nil {
+			m.slos.observe(endpoint, method, c.Writer.Status(), elapsed)
 		}
-		reqCount.WithLabelValues(lvs...).Inc()
-		reqDuration.WithLabelValues(lvs...).Observe(second)
-		reqSizeBytes.WithLabelValues(lvs...).Observe(calcRequestSize(c.Request))
-		respSizeBytes.WithLabelValues(lvs...).Observe(float64(respSize))
 	}
 }
 
+// observe records v on observer with the trace ID of the span of ctx as
+// exemplar, such as the one gintrace starts, when the span is sampled
+func observe(ctx context.Context, observer prometheus.Observer, v float64) {
+	sc := trace.SpanContextFromContext(ctx)
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok && sc.IsSampled() {
+		eo.ObserveWithExemplar(v, prometheus.Labels{traceIDLabel: sc.TraceID().String()})
+		return
+	}
+	observer.Observe(v)
+}
+
+// maxQueueTime bounds a queue time, a longer one is a bad or forged header
+const maxQueueTime = time.Hour
+
+// queueTime returns how long a request started at value, such as
+// t=1700000000.123 in seconds, milliseconds or microseconds, waited until
+// now. A start after now or more than maxQueueTime before it is invalid.
+func queueTime(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "t=")
+	v, err := strconv.ParseFloat(value, 64)
+	// past 1e18 microseconds the value overflows the conversion to int64
+	if err != nil || v <= 0 || v >= 1e18 {
+		return 0, false
+	}
+	var start time.Time
+	switch {
+	case v > 1e15:
+		start = time.UnixMicro(int64(v))
+	case v > 1e12:
+		start = time.UnixMilli(int64(v))
+	default:
+		start = time.Unix(0, int64(v*float64(time.Second)))
+	}
+	wait := now.Sub(start)
+	if wait < 0 || wait > maxQueueTime {
+		return 0, false
+	}
+	return wait, true
+}
+
 // promHandler wrappers the standard http.Handler to gin.HandlerFunc
 func promHandler(handler http.Handler) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,161 @@
+package prom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func serve(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func newRouter(m *Metrics) *gin.Engine {
+	r := gin.New()
+	r.Use(m.Handler())
+	r.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	return r
+}
+
+func TestInstancesAreIndependent(t *testing.T) {
+	a := NewMetrics()
+	defer a.Close()
+	b := NewMetrics()
+	defer b.Close()
+
+	serve(newRouter(a), "/ping")
+	assert.Equal(t, float64(1), testutil.ToFloat64(a.reqCount))
+	assert.Equal(t, 0, testutil.CollectAndCount(b.reqCount))
+}
+
+func TestRegistryAndClose(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := NewMetrics(WithRegistry(registry, nil))
+	assert.Equal(t, registry, m.Gatherer())
+	serve(newRouter(m), "/ping")
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, families)
+
+	m.Close()
+	m.Close()
+	families, err = registry.Gather()
+	assert.NoError(t, err)
+	assert.Empty(t, families)
+
+	// the collectors may be registered again once closed
+	assert.NotPanics(t, func() {
+		NewMetrics(WithRegistry(registry, nil)).Close()
+	})
+}
+
+func TestRegistryWithoutGatherer(t *testing.T) {
+	registerer := prometheus.WrapRegistererWithPrefix("app_", prometheus.NewRegistry())
+	assert.Panics(t, func() {
+		NewMetrics(WithRegistry(registerer, nil))
+	})
+}
+
+func TestPromHandler(t *testing.T) {
+	r := gin.New()
+	m := NewMetrics(WithPromHandler(r), WithHandlerUrl("/internal/metrics"), WithNamespace("app"))
+	defer m.Close()
+	r.Use(m.Handler())
+	r.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	serve(r, "/ping")
+	w := serve(r, "/internal/metrics")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `app_http_request_count_total{endpoint="/ping",method="GET",status="200"} 1`)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
+
+func TestRouteLabels(t *testing.T) {
+	m := NewMetrics()
+	defer m.Close()
+	r := newRouter(m)
+	r.GET("/users/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("id"))
+	})
+
+	serve(r, "/users/1")
+	serve(r, "/users/2")
+	serve(r, "/wp-login.php")
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.reqCount.WithLabelValues("200", "/users/:id", http.MethodGet)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.reqCount.WithLabelValues("404", UnmatchedRoute, http.MethodGet)))
+}
+
+func TestSeriesLimit(t *testing.T) {
+	m := NewMetrics(WithSeriesLimit(2), WithEndpointLabelMappingFn(func(c *gin.Context) string {
+		return c.Request.URL.Path
+	}))
+	defer m.Close()
+	r := newRouter(m)
+
+	for _, path := range []string{"/ping", "/a", "/b", "/c", "/ping"} {
+		serve(r, path)
+	}
+	assert.Equal(t, 3, testutil.CollectAndCount(m.reqCount))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.reqCount.WithLabelValues("200", "/ping", http.MethodGet)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.reqCount.WithLabelValues("404", OtherLabel, http.MethodGet)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.seriesCollapsed.WithLabelValues("http_request_count_total")))
+}
+
+func TestUniqueVisitors(t *testing.T) {
+	r := gin.New()
+	m := NewMetrics(WithPromHandler(r))
+	defer m.Close()
+	r.Use(m.Handler())
+	r.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.1"} {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = ip + ":1234"
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := serve(r, "/metrics")
+	assert.Contains(t, w.Body.String(), `service_request_uv{window="1h"} 2`)
+	assert.Contains(t, w.Body.String(), `service_request_uv{window="1d"} 2`)
+}
+
+func TestExemplars(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	r := gin.New()
+	m := NewMetrics(WithPromHandler(r))
+	defer m.Close()
+	r.Use(func(c *gin.Context) {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+		c.Request = c.Request.WithContext(trace.ContextWithSpanContext(c.Request.Context(), sc))
+	}, m.Handler())
+	r.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	serve(r, "/ping")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/openmetrics-text")
+	assert.Regexp(t, `service_http_request_duration_seconds_bucket\{endpoint="/ping",method="GET",status="200",le="0.1"\} 1 # \{trace_id="4bf92f3577b34da6a3ce929d0e0e4736"\}`, w.Body.String())
+}
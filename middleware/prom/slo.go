@@ -0,0 +1,196 @@
+package prom
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// burnRateSlots is the number of slots of a burn rate window, its precision
+// is a sixtieth of the window
+const burnRateSlots = 60
+
+// DefaultBurnRateWindows are the windows of the multi-window, multi-burn-rate
+// alerts of the SRE workbook, such as a 14.4 burn rate over both 1h and 5m
+var DefaultBurnRateWindows = []time.Duration{
+	5 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 6 * time.Hour, 24 * time.Hour, 72 * time.Hour,
+}
+
+// SLO is the objective of a route: a request is good when it does not fail
+// with a 5xx status and, if Latency is set, is handled within Latency.
+// Availability is the target ratio of good requests, such as 0.999.
+type SLO struct {
+	// Name is the slo label, it defaults to Route
+	Name string
+	// Route is the endpoint label the SLO applies to, such as /users/:id
+	Route string
+	// Method restricts the SLO to a method, empty for every method
+	Method string
+	// Latency is the threshold of a good request, 0 for no threshold
+	Latency time.Duration
+	// Availability is the target ratio of good requests
+	Availability float64
+}
+
+// meets reports whether a request of status handled in elapsed meets the SLO
+func (s SLO) meets(status int, elapsed time.Duration) bool {
+	return status < 500 && (s.Latency <= 0 || elapsed <= s.Latency)
+}
+
+// rollingWindow counts the good and bad events of the last size, in
+// burnRateSlots slots
+type rollingWindow struct {
+	label string
+	width int64
+	index [burnRateSlots]int64
+	good  [burnRateSlots]uint64
+	bad   [burnRateSlots]uint64
+}
+
+func newRollingWindow(size time.Duration) *rollingWindow {
+	width := int64(size) / burnRateSlots
+	if width <= 0 {
+		width = 1
+	}
+	return &rollingWindow{label: windowLabel(size), width: width}
+}
+
+func (w *rollingWindow) add(now int64, good bool) {
+	idx := now / w.width
+	s := idx % burnRateSlots
+	if w.index[s] != idx {
+		w.index[s], w.good[s], w.bad[s] = idx, 0, 0
+	}
+	if good {
+		w.good[s]++
+	} else {
+		w.bad[s]++
+	}
+}
+
+func (w *rollingWindow) sum(now int64) (good, bad uint64) {
+	first := now/w.width - burnRateSlots + 1
+	for s, idx := range w.index {
+		if idx >= first {
+			good += w.good[s]
+			bad += w.bad[s]
+		}
+	}
+	return good, bad
+}
+
+// windowLabel formats size as 5m, 1h or 3d
+func windowLabel(size time.Duration) string {
+	switch {
+	case size%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", size/(24*time.Hour))
+	case size%time.Hour == 0:
+		return fmt.Sprintf("%dh", size/time.Hour)
+	case size%time.Minute == 0:
+		return fmt.Sprintf("%dm", size/time.Minute)
+	}
+	return size.String()
+}
+
+type sloState struct {
+	SLO
+	mu      sync.Mutex
+	good    uint64
+	bad     uint64
+	windows []*rollingWindow
+}
+
+// burnRate returns how fast the error budget of the SLO is spent over w, 1
+// spends exactly the budget over the SLO period
+func (s *sloState) burnRate(w *rollingWindow, now int64) float64 {
+	good, bad := w.sum(now)
+	if good+bad == 0 {
+		return 0
+	}
+	return float64(bad) / float64(good+bad) / (1 - s.Availability)
+}
+
+// sloTracker is a prometheus.Collector exporting the good and bad events of
+// every SLO and their burn rates over each window
+type sloTracker struct {
+	slos     []*sloState
+	now      func() time.Time
+	events   *prometheus.Desc
+	burnRate *prometheus.Desc
+}
+
+func newSLOTracker(namespace string, slos []SLO, windows []time.Duration) *sloTracker {
+	t := &sloTracker{
+		now: time.Now,
+		events: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "http_slo_events_total"),
+			"HTTP requests counted by an SLO, by result good or bad.",
+			[]string{"slo", "result"}, nil,
+		),
+		burnRate: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "http_slo_burn_rate"),
+			"Error budget burn rate of an SLO over the rolling window, 1 spends exactly the budget.",
+			[]string{"slo", "window"}, nil,
+		),
+	}
+	for _, slo := range slos {
+		if slo.Availability <= 0 || slo.Availability >= 1 {
+			panic(fmt.Sprintf("prom: availability of SLO %q must be between 0 and 1", slo.Route))
+		}
+		if slo.Name == "" {
+			slo.Name = slo.Route
+		}
+		s := &sloState{SLO: slo}
+		for _, size := range windows {
+			s.windows = append(s.windows, newRollingWindow(size))
+		}
+		t.slos = append(t.slos, s)
+	}
+	return t
+}
+
+// observe counts a request in the SLOs of its endpoint and method
+func (t *sloTracker) observe(endpoint, method string, status int, elapsed time.Duration) {
+	var now int64
+	for _, s := range t.slos {
+		if s.Route != endpoint || (s.Method != "" && s.Method != method) {
+			continue
+		}
+		if now == 0 {
+			now = t.now().UnixNano()
+		}
+		good := s.meets(status, elapsed)
+		s.mu.Lock()
+		if good {
+			s.good++
+		} else {
+			s.bad++
+		}
+		for _, w := range s.windows {
+			w.add(now, good)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Describe implements prometheus.Collector
+func (t *sloTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.events
+	ch <- t.burnRate
+}
+
+// Collect implements prometheus.Collector
+func (t *sloTracker) Collect(ch chan<- prometheus.Metric) {
+	now := t.now().UnixNano()
+	for _, s := range t.slos {
+		s.mu.Lock()
+		ch <- prometheus.MustNewConstMetric(t.events, prometheus.CounterValue, float64(s.good), s.Name, "good")
+		ch <- prometheus.MustNewConstMetric(t.events, prometheus.CounterValue, float64(s.bad), s.Name, "bad")
+		for _, w := range s.windows {
+			ch <- prometheus.MustNewConstMetric(t.burnRate, prometheus.GaugeValue, s.burnRate(w, now), s.Name, w.label)
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,118 @@
+package prom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInFlight(t *testing.T) {
+	m := NewMetrics()
+	defer m.Close()
+	r := newRouter(m)
+	var during float64
+	r.GET("/users/:id", func(c *gin.Context) {
+		during = testutil.ToFloat64(m.reqInFlight.WithLabelValues(http.MethodGet, "/users/:id"))
+	})
+
+	serve(r, "/users/1")
+	assert.Equal(t, float64(1), during)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.reqInFlight.WithLabelValues(http.MethodGet, "/users/:id")))
+}
+
+func TestQueueTime(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, value := range []string{
+		"t=1699999999.750",
+		"1699999999750",
+		"t=1699999999750000",
+	} {
+		wait, ok := queueTime(value, now)
+		assert.True(t, ok, value)
+		assert.InDelta(t, float64(250*time.Millisecond), float64(wait), float64(time.Millisecond), value)
+	}
+
+	// a start in the future, decades ago or out of range is invalid
+	for _, value := range []string{"", "t=abc", "t=1700000001", "1", "t=1e300", "9e18"} {
+		_, ok := queueTime(value, now)
+		assert.False(t, ok, value)
+	}
+
+	m := NewMetrics()
+	defer m.Close()
+	r := newRouter(m)
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("X-Request-Start", "t="+strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	serve(r, "/ping")
+	assert.Equal(t, 1, testutil.CollectAndCount(m.reqQueue))
+}
+
+func TestSLO(t *testing.T) {
+	r := gin.New()
+	m := NewMetrics(WithPromHandler(r), WithSLOs(SLO{
+		Name:         "users",
+		Route:        "/users/:id",
+		Latency:      time.Second,
+		Availability: 0.9,
+	}), WithBurnRateWindows(5*time.Minute, time.Hour))
+	defer m.Close()
+	r.Use(m.Handler())
+	r.GET("/users/:id", func(c *gin.Context) {
+		status, _ := strconv.Atoi(c.Param("id"))
+		c.Status(status)
+	})
+	r.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	for _, path := range []string{"/users/200", "/users/404", "/users/500", "/users/200", "/ping"} {
+		serve(r, path)
+	}
+	body := serve(r, "/metrics").Body.String()
+	assert.Contains(t, body, `service_http_slo_events_total{result="good",slo="users"} 3`)
+	assert.Contains(t, body, `service_http_slo_events_total{result="bad",slo="users"} 1`)
+	// a quarter of the requests failed for a budget of a tenth
+	assert.Contains(t, body, `service_http_slo_burn_rate{slo="users",window="5m"} 2.5`)
+	assert.Contains(t, body, `service_http_slo_burn_rate{slo="users",window="1h"} 2.5`)
+}
+
+func TestSLOWindows(t *testing.T) {
+	tracker := newSLOTracker("service", []SLO{{Route: "/ping", Availability: 0.99}}, []time.Duration{5 * time.Minute, time.Hour})
+	now := time.Unix(1700000000, 0)
+	tracker.now = func() time.Time { return now }
+	s := tracker.slos[0]
+
+	tracker.observe("/ping", http.MethodGet, http.StatusInternalServerError, 0)
+	tracker.observe("/ping", http.MethodGet, http.StatusOK, 2*time.Second)
+	tracker.observe("/pong", http.MethodGet, http.StatusInternalServerError, 0)
+	assert.Equal(t, "/ping", s.Name)
+	assert.InDelta(t, 50, s.burnRate(s.windows[0], now.UnixNano()), 1e-9)
+
+	// the failure leaves the 5m window but not the 1h one
+	now = now.Add(10 * time.Minute)
+	tracker.observe("/ping", http.MethodGet, http.StatusOK, 0)
+	assert.InDelta(t, 0, s.burnRate(s.windows[0], now.UnixNano()), 1e-9)
+	assert.InDelta(t, 100.0/3, s.burnRate(s.windows[1], now.UnixNano()), 1e-9)
+
+	now = now.Add(2 * time.Hour)
+	assert.InDelta(t, 0, s.burnRate(s.windows[1], now.UnixNano()), 1e-9)
+	assert.Equal(t, uint64(2), s.good)
+	assert.Equal(t, uint64(1), s.bad)
+}
+
+func TestSLOAvailability(t *testing.T) {
+	assert.Panics(t, func() {
+		newSLOTracker("service", []SLO{{Route: "/ping", Availability: 1}}, DefaultBurnRateWindows)
+	})
+	assert.Equal(t, "5m", windowLabel(5*time.Minute))
+	assert.Equal(t, "6h", windowLabel(6*time.Hour))
+	assert.Equal(t, "3d", windowLabel(72*time.Hour))
+	assert.Equal(t, "1m30s", windowLabel(90*time.Second))
+}
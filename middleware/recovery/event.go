@@ -0,0 +1,101 @@
+package recovery
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// frames of the panicking goroutine kept in an event, and hashed in its fingerprint
+const (
+	maxFrames         = 64
+	fingerprintFrames = 5
+)
+
+// Frame is a function call of the panicking goroutine
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Event describes a recovered panic
+type Event struct {
+	Time  time.Time   `json:"time"`
+	Value interface{} `json:"-"`
+	// Type and Message are the %T and %v of the panic value
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// Fingerprint identifies the panic site, the same bug panicking again
+	// has the same fingerprint
+	Fingerprint string  `json:"fingerprint"`
+	Frames      []Frame `json:"frames"`
+	// Transport is http or grpc, Route the route template or the full gRPC method
+	Transport string `json:"transport"`
+	Route     string `json:"route"`
+	Method    string `json:"method,omitempty"`
+	Request   string `json:"request,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+	// Count is the number of panics with this fingerprint so far, Suppressed
+	// the number not reported since the previous report by the rate limit
+	Count      uint64 `json:"count"`
+	Suppressed uint64 `json:"suppressed"`
+	// BrokenPipe is set when the client went away, no response was written
+	BrokenPipe bool `json:"broken_pipe,omitempty"`
+}
+
+// Stack formats the frames like a goroutine dump
+func (e *Event) Stack() string {
+	var b strings.Builder
+	for _, f := range e.Frames {
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+	}
+	return b.String()
+}
+
+// callers returns the stack of the calling goroutine from the panicking
+// function down, or from the caller of callers outside of a panic
+func callers() []Frame {
+	pcs := make([]uintptr, maxFrames)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack []Frame
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			break
+		}
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Function == "runtime.gopanic" {
+			stack = stack[i+1:]
+			// runtime.panicmem, runtime.sigpanic...
+			for len(stack) > 0 && strings.HasPrefix(stack[0].Function, "runtime.") {
+				stack = stack[1:]
+			}
+			break
+		}
+	}
+	return stack
+}
+
+// fingerprint hashes the panic type and the functions at the top of the
+// stack. Line numbers and the message are left out, they change between
+// releases and with the data.
+func fingerprint(typ string, frames []Frame) string {
+	h := sha1.New()
+	h.Write([]byte(typ))
+	for i, f := range frames {
+		if i == fingerprintFrames {
+			break
+		}
+		h.Write([]byte{'\n'})
+		h.Write([]byte(f.Function))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,50 @@
+package recovery
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Option for the recovery Pipeline
+type Option func(*option)
+
+type option struct {
+	reporters []Reporter
+	interval  time.Duration
+	redact    map[string]bool
+	response  func(c *gin.Context, e *Event)
+}
+
+// WithReporter add reporters of the recovered panics
+func WithReporter(reporters ...Reporter) Option {
+	return func(o *option) {
+		o.reporters = append(o.reporters, reporters...)
+	}
+}
+
+// WithRateLimit report a fingerprint at most once per interval (default 10s),
+// the repeats in between are counted in the next report. 0 reports every panic.
+func WithRateLimit(interval time.Duration) Option {
+	return func(o *option) {
+		o.interval = interval
+	}
+}
+
+// WithRedactHeaders hide more request headers in reports, Authorization,
+// Proxy-Authorization, Cookie and X-Api-Key are always hidden
+func WithRedactHeaders(headers ...string) Option {
+	return func(o *option) {
+		for _, h := range headers {
+			o.redact[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+}
+
+// WithResponse replace the JSON 500 response, fn must abort c
+func WithResponse(fn func(c *gin.Context, e *Event)) Option {
+	return func(o *option) {
+		o.response = fn
+	}
+}
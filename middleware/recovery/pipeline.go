@@ -0,0 +1,166 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/donetkit/contrib-gin/middleware/requestid"
+	"github.com/gin-gonic/gin"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	redacted        = "[REDACTED]"
+)
+
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// Reporter receives the recovered panics
+type Reporter interface {
+	Report(e *Event)
+}
+
+// Observer is implemented by reporters that must see every panic, such as
+// counters, and not only the rate limited reports
+type Observer interface {
+	Observe(e *Event)
+}
+
+// ReporterFunc is a function Reporter
+type ReporterFunc func(e *Event)
+
+// Report implements Reporter
+func (f ReporterFunc) Report(e *Event) {
+	f(e)
+}
+
+// Pipeline captures panics into events, counts them by fingerprint and
+// hands them to the reporters, at most once per interval and fingerprint
+type Pipeline struct {
+	*option
+	mu   sync.Mutex
+	seen map[string]*occurrences
+}
+
+type occurrences struct {
+	count      uint64
+	suppressed uint64
+	reported   time.Time
+}
+
+// NewPipeline creates a Pipeline configured by WithReporter, WithRateLimit
+// and WithRedactHeaders
+func NewPipeline(opts ...Option) *Pipeline {
+	o := &option{
+		interval: defaultInterval,
+		redact:   map[string]bool{},
+		response: defaultResponse,
+	}
+	for _, h := range defaultRedactHeaders {
+		o.redact[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Pipeline{option: o, seen: map[string]*occurrences{}}
+}
+
+// Capture builds the event of the panic value p, it must be called from the
+// deferred function that recovered p. Transports set the route and request.
+func (p *Pipeline) Capture(ctx context.Context, value interface{}) *Event {
+	e := &Event{
+		Time:    time.Now(),
+		Value:   value,
+		Type:    fmt.Sprintf("%T", value),
+		Message: fmt.Sprintf("%v", value),
+		Frames:  callers(),
+	}
+	e.Fingerprint = fingerprint(e.Type, e.Frames)
+	if ctx != nil {
+		e.RequestID = requestid.FromContext(ctx)
+		if sc := oteltrace.SpanContextFromContext(ctx); sc.HasTraceID() {
+			e.TraceID = sc.TraceID().String()
+		}
+	}
+	return e
+}
+
+// Report counts e and passes it to the reporters unless its fingerprint was
+// reported less than the rate limit interval ago
+func (p *Pipeline) Report(e *Event) {
+	p.mu.Lock()
+	occ, ok := p.seen[e.Fingerprint]
+	if !ok {
+		occ = &occurrences{}
+		p.seen[e.Fingerprint] = occ
+	}
+	occ.count++
+	e.Count = occ.count
+	for _, r := range p.reporters {
+		if o, ok := r.(Observer); ok {
+			o.Observe(e)
+		}
+	}
+	if p.interval > 0 && !occ.reported.IsZero() && e.Time.Sub(occ.reported) < p.interval {
+		occ.suppressed++
+		p.mu.Unlock()
+		return
+	}
+	e.Suppressed = occ.suppressed
+	occ.suppressed = 0
+	occ.reported = e.Time
+	p.mu.Unlock()
+
+	for _, r := range p.reporters {
+		r.Report(e)
+	}
+}
+
+// dump returns the request line and headers, with credentials redacted
+func (p *Pipeline) dump(r *http.Request) string {
+	clone := r.Clone(r.Context())
+	for name := range clone.Header {
+		if p.redact[name] {
+			clone.Header[name] = []string{redacted}
+		}
+	}
+	data, _ := httputil.DumpRequest(clone, false)
+	return string(data)
+}
+
+// recover captures, reports and answers a panic of the gin chain
+func (p *Pipeline) recover(c *gin.Context, value interface{}) {
+	e := p.Capture(c.Request.Context(), value)
+	e.Transport = "http"
+	e.Route = c.FullPath()
+	e.Method = c.Request.Method
+	e.Request = p.dump(c.Request)
+	e.BrokenPipe = brokenPipe(value)
+	if e.RequestID == "" {
+		e.RequestID = c.Writer.Header().Get("X-Request-Id")
+	}
+	p.Report(e)
+
+	if e.BrokenPipe {
+		// If the connection is dead, we can't write a status to it.
+		if err, ok := value.(error); ok {
+			_ = c.Error(err)
+		}
+		c.Abort()
+		return
+	}
+	p.response(c, e)
+}
+
+func defaultResponse(c *gin.Context, e *Event) {
+	body := gin.H{"error": http.StatusText(http.StatusInternalServerError)}
+	if e.RequestID != "" {
+		body["request_id"] = e.RequestID
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, body)
+}
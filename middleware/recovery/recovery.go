@@ -1,48 +1,36 @@
 package recovery
 
 import (
-	"fmt"
-	"github.com/donetkit/contrib-log/glog"
 	"net"
-	"net/http"
-	"net/http/httputil"
 	"os"
-	"runtime/debug"
 	"strings"
-	"time"
 
+	"github.com/donetkit/contrib-log/glog"
 	"github.com/gin-gonic/gin"
 )
 
-// New returns a gin.HandlerFunc (middleware)
+// New returns a gin.HandlerFunc (middleware) logging panics, with their stack
+// if stack is set, and answering with a JSON 500
 func New(logger glog.ILogger, stack ...bool) gin.HandlerFunc {
 	logs := logger.WithField("Gin-Recover", "Gin-Recover")
+	return NewReporting(
+		WithReporter(&logReporter{logger: logs, stack: len(stack) > 0 && stack[0]}),
+		WithRateLimit(0),
+	)
+}
+
+// NewReporting returns a middleware recovering panics of the chain into the
+// reporters of a Pipeline configured by opts
+func NewReporting(opts ...Option) gin.HandlerFunc {
+	return NewPipeline(opts...).Handler()
+}
+
+// Handler returns a middleware recovering panics into p
+func (p *Pipeline) Handler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				var brokenPipe bool
-				if ne, ok := err.(*net.OpError); ok {
-					if se, ok := ne.Err.(*os.SyscallError); ok {
-						if strings.Contains(strings.ToLower(se.Error()), "broken pipe") || strings.Contains(strings.ToLower(se.Error()), "connection reset by peer") {
-							brokenPipe = true
-						}
-					}
-				}
-				httpRequest, _ := httputil.DumpRequest(c.Request, false)
-				if brokenPipe {
-					logs.Error(fmt.Sprintf("path: %s error: %s request: %s", c.Request.URL.Path, err, string(httpRequest)))
-					// If the connection is dead, we can't write a status to it.
-					c.Error(err.(error)) // nolint:
-					c.Abort()
-					return
-				}
-				if len(stack) > 0 && stack[0] {
-					logs.Error("[Recovery from panic] %s error: %s request: %s stack: %s", time.Now().Format(time.RFC3339), err, string(httpRequest), string(debug.Stack()))
-
-				} else {
-					logs.Error("[Recovery from panic] %s error: %s request: %s", time.Now().Format(time.RFC3339), err, string(httpRequest))
-				}
-				c.AbortWithStatus(http.StatusInternalServerError)
+				p.recover(c, err)
 			}
 		}()
 		c.Next()
@@ -63,3 +51,14 @@ func NewRecovery(handlers ...func(any any)) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func brokenPipe(err interface{}) bool {
+	if ne, ok := err.(*net.OpError); ok {
+		if se, ok := ne.Err.(*os.SyscallError); ok {
+			if strings.Contains(strings.ToLower(se.Error()), "broken pipe") || strings.Contains(strings.ToLower(se.Error()), "connection reset by peer") {
+				return true
+			}
+		}
+	}
+	return false
+}
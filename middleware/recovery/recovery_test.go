@@ -0,0 +1,154 @@
+package recovery
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func panicking(c *gin.Context) {
+	var m map[string]int
+	m["boom"]++
+}
+
+func newRouter(opts ...Option) (*gin.Engine, *[]*Event) {
+	var events []*Event
+	opts = append([]Option{WithReporter(ReporterFunc(func(e *Event) {
+		events = append(events, e)
+	}))}, opts...)
+	r := gin.New()
+	r.Use(NewReporting(opts...))
+	r.GET("/users/:id", panicking)
+	r.GET("/other", func(c *gin.Context) {
+		panic("other")
+	})
+	return r, &events
+}
+
+func get(r *gin.Engine, path string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestReportEvent(t *testing.T) {
+	r, events := newRouter()
+	w := get(r, "/users/1", http.Header{
+		"Authorization": {"Bearer secret"},
+		"Accept":        {"application/json"},
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Internal Server Error"}`, w.Body.String())
+	if !assert.Len(t, *events, 1) {
+		return
+	}
+	e := (*events)[0]
+	assert.Equal(t, "/users/:id", e.Route)
+	assert.Equal(t, http.MethodGet, e.Method)
+	assert.True(t, strings.HasPrefix(e.Type, "runtime."), e.Type)
+	assert.Contains(t, e.Message, "assignment to entry in nil map")
+	assert.Contains(t, e.Frames[0].Function, "recovery.panicking")
+	assert.NotContains(t, e.Request, "secret")
+	assert.Contains(t, e.Request, "Authorization: [REDACTED]")
+	assert.Contains(t, e.Request, "Accept: application/json")
+	assert.Len(t, e.Fingerprint, 16)
+	assert.Equal(t, uint64(1), e.Count)
+}
+
+func TestFingerprintRateLimit(t *testing.T) {
+	r, events := newRouter(WithRateLimit(time.Hour))
+	for i := 0; i < 3; i++ {
+		get(r, "/users/1", nil)
+	}
+	get(r, "/other", nil)
+
+	if !assert.Len(t, *events, 2) {
+		return
+	}
+	assert.NotEqual(t, (*events)[0].Fingerprint, (*events)[1].Fingerprint)
+
+	p := NewPipeline(WithRateLimit(time.Millisecond))
+	var last *Event
+	p.reporters = []Reporter{ReporterFunc(func(e *Event) { last = e })}
+	first := &Event{Time: time.Now(), Fingerprint: "f"}
+	p.Report(first)
+	p.Report(&Event{Time: first.Time, Fingerprint: "f"})
+	p.Report(&Event{Time: first.Time, Fingerprint: "f"})
+	p.Report(&Event{Time: first.Time.Add(time.Second), Fingerprint: "f"})
+	assert.Equal(t, uint64(4), last.Count)
+	assert.Equal(t, uint64(2), last.Suppressed)
+}
+
+func TestCustomResponse(t *testing.T) {
+	r, _ := newRouter(WithResponse(func(c *gin.Context, e *Event) {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"code": e.Fingerprint})
+	}))
+	w := get(r, "/other", nil)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"code"`)
+}
+
+func TestFileAndMetricsReporters(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "panics.log")
+	file, err := NewFileReporter(filename)
+	if !assert.NoError(t, err) {
+		return
+	}
+	metrics := NewMetricsReporter("test")
+	r, _ := newRouter(WithReporter(file, metrics), WithRateLimit(time.Hour))
+	get(r, "/other", nil)
+	get(r, "/other", nil)
+	get(r, "/users/1", nil)
+	assert.NoError(t, file.Close())
+
+	f, err := os.Open(filename)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "other", lines[0]["message"])
+		assert.Equal(t, "/other", lines[0]["route"])
+	}
+
+	// the panic of /other suppressed by the rate limit is counted too
+	for _, e := range []struct {
+		route string
+		count int
+	}{{"/other", 2}, {"/users/:id", 1}} {
+		assert.Equal(t, float64(e.count), testutil.ToFloat64(metrics.panics.WithLabelValues(fingerprintOf(t, lines, e.route), e.route)))
+	}
+}
+
+func fingerprintOf(t *testing.T, lines []map[string]interface{}, route string) string {
+	for _, line := range lines {
+		if line["route"] == route {
+			return line["fingerprint"].(string)
+		}
+	}
+	t.Fatalf("no report of %s", route)
+	return ""
+}
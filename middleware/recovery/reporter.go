@@ -0,0 +1,103 @@
+package recovery
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/donetkit/contrib-log/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type logReporter struct {
+	logger glog.ILoggerEntry
+	stack  bool
+}
+
+// NewLogReporter logs panics at error level, with their stack if stack is set
+func NewLogReporter(logger glog.ILogger, stack bool) Reporter {
+	if logger == nil {
+		return &logReporter{}
+	}
+	return &logReporter{logger: logger.WithField("Recover", "Recover"), stack: stack}
+}
+
+func (r *logReporter) Report(e *Event) {
+	if r.logger == nil {
+		return
+	}
+	if r.stack {
+		r.logger.Errorf("[Recovery from panic] %s error: %s route: %s fingerprint: %s count: %d suppressed: %d request_id: %s request: %s stack: %s",
+			e.Time.Format("2006-01-02T15:04:05Z07:00"), e.Message, e.Route, e.Fingerprint, e.Count, e.Suppressed, e.RequestID, e.Request, e.Stack())
+		return
+	}
+	r.logger.Errorf("[Recovery from panic] %s error: %s route: %s fingerprint: %s count: %d suppressed: %d request_id: %s request: %s",
+		e.Time.Format("2006-01-02T15:04:05Z07:00"), e.Message, e.Route, e.Fingerprint, e.Count, e.Suppressed, e.RequestID, e.Request)
+}
+
+// FileReporter appends panics to a file, one JSON object per line
+type FileReporter struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileReporter opens or creates filename for appending
+func NewFileReporter(filename string) (*FileReporter, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileReporter{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Report implements Reporter
+func (r *FileReporter) Report(e *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(e)
+}
+
+// Close closes the file
+func (r *FileReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// MetricsReporter counts panics by fingerprint and route. It is a
+// prometheus.Collector, register it through prom.WithCollectors.
+type MetricsReporter struct {
+	panics *prometheus.CounterVec
+}
+
+// NewMetricsReporter creates the panics_total counter under namespace
+func NewMetricsReporter(namespace string) *MetricsReporter {
+	return &MetricsReporter{
+		panics: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "panics_total",
+				Help:      "Recovered panics by fingerprint and route.",
+			}, []string{"fingerprint", "route"},
+		),
+	}
+}
+
+// Report implements Reporter, panics are counted by Observe
+func (r *MetricsReporter) Report(e *Event) {}
+
+// Observe implements Observer, counting the panics suppressed by the rate limit too
+func (r *MetricsReporter) Observe(e *Event) {
+	r.panics.WithLabelValues(e.Fingerprint, e.Route).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (r *MetricsReporter) Describe(ch chan<- *prometheus.Desc) {
+	r.panics.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (r *MetricsReporter) Collect(ch chan<- prometheus.Metric) {
+	r.panics.Collect(ch)
+}
@@ -0,0 +1,20 @@
+package requestid
+
+import "context"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the request id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id stored by New, NewContext or the
+// grpc_requestid server interceptors, or an empty string
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
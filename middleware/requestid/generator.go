@@ -0,0 +1,87 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// crockford base32, as used by ULIDs
+const ulidEncoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates 26 character ULIDs, a millisecond timestamp followed by 80
+// random bits, which sort by creation time
+func ULID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	_, _ = rand.Read(b[6:])
+
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = ulidEncoding[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxNode      = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch is 2020-01-01, 41 bits of milliseconds last until 2089
+var snowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type snowflake struct {
+	mu       sync.Mutex
+	node     int64
+	last     int64
+	sequence int64
+}
+
+// NewSnowflake returns a Generator of Snowflake-style 64-bit ids written in
+// decimal: 41 bits of milliseconds, 10 bits of node and a 12 bit sequence.
+// Every instance generating ids must use its own node, from 0 to 1023.
+func NewSnowflake(node int64) Generator {
+	if node < 0 || node > snowflakeMaxNode {
+		panic("requestid: snowflake node must be between 0 and 1023")
+	}
+	s := &snowflake{node: node}
+	return s.next
+}
+
+func (s *snowflake) next() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Since(snowflakeEpoch).Milliseconds()
+	// never go back in time, ids would repeat
+	if now < s.last {
+		now = s.last
+	}
+	if now == s.last {
+		s.sequence = (s.sequence + 1) & snowflakeMaxSequence
+		if s.sequence == 0 {
+			for now <= s.last {
+				time.Sleep(time.Millisecond / 10)
+				now = time.Since(snowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.last = now
+	id := now<<(snowflakeNodeBits+snowflakeSequenceBits) | s.node<<snowflakeSequenceBits | s.sequence
+	return strconv.FormatInt(id, 10)
+}
@@ -18,3 +18,38 @@ func WithCustomHeaderStrKey(s string) Option {
 		cfg.headerKey = s
 	}
 }
+
+// WithMaxLength set the longest incoming id kept (default 128), longer ones
+// are replaced by a generated id
+func WithMaxLength(n int) Option {
+	return func(cfg *config) {
+		cfg.maxLength = n
+	}
+}
+
+// WithValidator replace the check of incoming ids, which by default only
+// accepts letters, digits and -_.:/+=@
+func WithValidator(fn func(id string) bool) Option {
+	return func(cfg *config) {
+		cfg.validator = fn
+	}
+}
+
+// WithTrustedProxies only keep incoming ids sent by these addresses or CIDR
+// ranges, ids from other clients are replaced by a generated id
+func WithTrustedProxies(proxies ...string) Option {
+	nets := parseProxies(proxies)
+	return func(cfg *config) {
+		cfg.trustedProxies = nets
+	}
+}
+
+// WithTraceID use the trace id as request id, so logs and traces share one id.
+// It is taken from the span started by gintrace when used after it, else from
+// the W3C traceparent header of a trusted peer, and takes precedence over the
+// request header.
+func WithTraceID() Option {
+	return func(cfg *config) {
+		cfg.traceID = true
+	}
+}
@@ -1,13 +1,13 @@
 package requestid
 
 import (
+	"net"
+
 	"github.com/donetkit/contrib/utils/uuid"
 	"github.com/gin-gonic/gin"
 )
 
-var headerXRequestID string
-
-var headerRequestIdKey = "X-Request-Id"
+const headerXRequestID = "X-Request-Id"
 
 // Config defines the config for RequestID middleware
 type config struct {
@@ -15,8 +15,12 @@ type config struct {
 	// Optional. Default: func() string {
 	//   return uuid.New().String()
 	// }
-	generator Generator
-	headerKey string
+	generator      Generator
+	headerKey      string
+	maxLength      int
+	validator      func(id string) bool
+	trustedProxies []*net.IPNet
+	traceID        bool
 }
 
 // New initializes the RequestID middleware.
@@ -25,25 +29,33 @@ func New(opts ...Option) gin.HandlerFunc {
 		generator: func() string {
 			return uuid.NewUUID()
 		},
-		headerKey: headerRequestIdKey,
+		headerKey: headerXRequestID,
+		maxLength: DefaultMaxLength,
 	}
 	for _, opt := range opts {
 		opt(cfg)
 	}
-	headerXRequestID = cfg.headerKey
 	return func(c *gin.Context) {
+		var rid string
+		if cfg.traceID {
+			rid = traceID(c, cfg.trusted(c))
+		}
 		// Get id from request
-		rid := c.GetHeader(cfg.headerKey)
+		if rid == "" {
+			rid = cfg.incoming(c)
+		}
 		if rid == "" {
 			rid = cfg.generator()
 		}
 		// Set the id to ensure that the requestid is in the response
 		c.Header(cfg.headerKey, rid)
+		// and in the request context for handlers, clients and loggers
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), rid))
 		c.Next()
 	}
 }
 
 // Get returns the request identifier
 func Get(c *gin.Context) string {
-	return c.Writer.Header().Get(headerXRequestID)
+	return FromContext(c.Request.Context())
 }
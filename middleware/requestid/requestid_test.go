@@ -4,7 +4,9 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -79,3 +81,147 @@ func TestRequestIDWithCustomHeaderKey(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, testXRequestID, w.Header().Get("customKey"))
 }
+
+func TestRequestIDInContext(t *testing.T) {
+	r := gin.New()
+	r.Use(New(WithCustomHeaderStrKey("customKey")))
+	r.GET("/", func(c *gin.Context) {
+		assert.Equal(t, testXRequestID, FromContext(c.Request.Context()))
+		c.String(http.StatusOK, Get(c))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	req.Header.Set("customKey", testXRequestID)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, testXRequestID, w.Body.String())
+}
+
+func TestTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("customKey")))
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: NewTransport(nil, WithCustomHeaderStrKey("customKey"))}
+
+	r := gin.New()
+	r.Use(New(WithCustomHeaderStrKey("customKey")))
+	r.GET("/", func(c *gin.Context) {
+		req, _ := http.NewRequestWithContext(c.Request.Context(), "GET", upstream.URL, nil)
+		resp, err := client.Do(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer resp.Body.Close()
+		assert.Empty(t, req.Header.Get("customKey"))
+		c.DataFromReader(http.StatusOK, resp.ContentLength, "text/plain", resp.Body, nil)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	req.Header.Set("customKey", testXRequestID)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, testXRequestID, w.Body.String())
+}
+
+func requestIDOf(r *gin.Engine, remoteAddr string, header http.Header) string {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	r.ServeHTTP(w, req)
+	return w.Header().Get(headerXRequestID)
+}
+
+func TestRequestIDValidation(t *testing.T) {
+	r := gin.New()
+	r.Use(New(WithMaxLength(16), WithGenerator(func() string { return "generated" })))
+	r.GET("/", emptySuccessResponse)
+
+	for id, want := range map[string]string{
+		testXRequestID:          testXRequestID,
+		"abc\r\nX-Injected: 1":  "generated",
+		"with space":            "generated",
+		"0123456789abcdefg":     "generated",
+		"user@host:1/a+b=c_d.e": "generated",
+		"a@b:1/c+d=e_f.g":       "a@b:1/c+d=e_f.g",
+	} {
+		assert.Equal(t, want, requestIDOf(r, "192.0.2.1:1234", http.Header{headerXRequestID: {id}}), id)
+	}
+
+	r = gin.New()
+	r.Use(New(WithValidator(func(id string) bool { return id == "only" })))
+	r.GET("/", emptySuccessResponse)
+	assert.Equal(t, "only", requestIDOf(r, "192.0.2.1:1234", http.Header{headerXRequestID: {"only"}}))
+	assert.NotEqual(t, testXRequestID, requestIDOf(r, "192.0.2.1:1234", http.Header{headerXRequestID: {testXRequestID}}))
+}
+
+func TestRequestIDTrustedProxies(t *testing.T) {
+	r := gin.New()
+	r.Use(New(WithTrustedProxies("10.0.0.0/8", "192.0.2.1")))
+	r.GET("/", emptySuccessResponse)
+	header := http.Header{headerXRequestID: {testXRequestID}}
+
+	assert.Equal(t, testXRequestID, requestIDOf(r, "10.1.2.3:1234", header))
+	assert.Equal(t, testXRequestID, requestIDOf(r, "192.0.2.1:1234", header))
+	assert.NotEqual(t, testXRequestID, requestIDOf(r, "192.0.2.2:1234", header))
+	assert.Panics(t, func() { WithTrustedProxies("not-an-ip") })
+}
+
+func TestRequestIDFromTraceParent(t *testing.T) {
+	r := gin.New()
+	r.Use(New(WithTraceID()))
+	r.GET("/", emptySuccessResponse)
+
+	id := requestIDOf(r, "192.0.2.1:1234", http.Header{
+		"Traceparent":    {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		headerXRequestID: {testXRequestID},
+	})
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", id)
+
+	id = requestIDOf(r, "192.0.2.1:1234", http.Header{
+		"Traceparent":    {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		headerXRequestID: {testXRequestID},
+	})
+	assert.Equal(t, testXRequestID, id)
+
+	// an untrusted peer can't choose the id through traceparent either
+	r = gin.New()
+	r.Use(New(WithTraceID(), WithTrustedProxies("10.0.0.0/8")))
+	r.GET("/", emptySuccessResponse)
+	header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", requestIDOf(r, "10.1.2.3:1234", header))
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", requestIDOf(r, "192.0.2.1:1234", header))
+}
+
+func TestULID(t *testing.T) {
+	prev := ULID()
+	assert.Len(t, prev, 26)
+	assert.Regexp(t, "^[0-9A-HJKMNP-TV-Z]{26}$", prev)
+	time.Sleep(2 * time.Millisecond)
+	next := ULID()
+	assert.Less(t, prev, next)
+	assert.Equal(t, prev[:1], "0")
+}
+
+func TestSnowflake(t *testing.T) {
+	gen := NewSnowflake(7)
+	seen := map[string]bool{}
+	var last int64
+	for i := 0; i < 10000; i++ {
+		id := gen()
+		assert.False(t, seen[id], id)
+		seen[id] = true
+		n, err := strconv.ParseInt(id, 10, 64)
+		assert.NoError(t, err)
+		assert.Greater(t, n, last)
+		assert.Equal(t, int64(7), n>>snowflakeSequenceBits&snowflakeMaxNode)
+		last = n
+	}
+	assert.Panics(t, func() { NewSnowflake(1024) })
+}
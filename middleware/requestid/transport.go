@@ -0,0 +1,42 @@
+package requestid
+
+import "net/http"
+
+// Transport is an http.RoundTripper that forwards the request id found in
+// the context of outgoing requests, so downstream services log the same id
+type Transport struct {
+	// Base is the underlying RoundTripper, http.DefaultTransport when nil
+	Base      http.RoundTripper
+	headerKey string
+}
+
+// NewTransport wraps base, the header key is set by WithCustomHeaderStrKey
+func NewTransport(base http.RoundTripper, opts ...Option) *Transport {
+	cfg := &config{
+		headerKey: headerXRequestID,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return &Transport{Base: base, headerKey: cfg.headerKey}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	headerKey := t.headerKey
+	if headerKey == "" {
+		headerKey = headerXRequestID
+	}
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(headerKey) != "" {
+		return base.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set(headerKey, id)
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,107 @@
+package requestid
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// DefaultMaxLength is the longest incoming id kept by default
+const DefaultMaxLength = 128
+
+// ValidID accepts ids of at most maxLength letters, digits and -_.:/+=@,
+// which cannot break a log line or a header
+func ValidID(id string, maxLength int) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		switch ch := id[i]; {
+		case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z', '0' <= ch && ch <= '9':
+		case strings.IndexByte("-_.:/+=@", ch) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func parseProxies(proxies []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				panic(fmt.Sprintf("requestid: invalid trusted proxy %q", proxy))
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			panic(fmt.Sprintf("requestid: invalid trusted proxy %q", proxy))
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// trusted reports whether the id sent by the peer of c may be kept
+func (cfg *config) trusted(c *gin.Context) bool {
+	if cfg.trustedProxies == nil {
+		return true
+	}
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range cfg.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// incoming returns the id sent with the request if it is valid and trusted
+func (cfg *config) incoming(c *gin.Context) string {
+	id := c.GetHeader(cfg.headerKey)
+	if id == "" || !cfg.trusted(c) {
+		return ""
+	}
+	if cfg.validator != nil {
+		if !cfg.validator(id) {
+			return ""
+		}
+	} else if !ValidID(id, cfg.maxLength) {
+		return ""
+	}
+	return id
+}
+
+// traceID returns the trace id of the span started by gintrace, or else the
+// one of a valid W3C traceparent header sent by a trusted peer
+func traceID(c *gin.Context, trusted bool) string {
+	if sc := oteltrace.SpanContextFromContext(c.Request.Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	if !trusted {
+		return ""
+	}
+	// version-traceid-parentid-flags
+	parts := strings.Split(c.GetHeader("traceparent"), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ""
+	}
+	id, err := oteltrace.TraceIDFromHex(parts[1])
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
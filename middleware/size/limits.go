@@ -0,0 +1,254 @@
+package limits
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMultipartMemory = 32 << 20
+
+	policyContextKey = "github.com/donetkit/contrib-gin/middleware/size/policy"
+)
+
+// Reasons of a LimitError
+const (
+	ReasonContentLength = "content_length"
+	ReasonBodySize      = "body_size"
+	ReasonDecompressed  = "decompressed_size"
+	ReasonFileCount     = "file_count"
+	ReasonFileSize      = "file_size"
+	ReasonFilesSize     = "files_size"
+)
+
+// LimitError describes which limit a request went over, it is added to the
+// context errors and sent as the 413 JSON body
+type LimitError struct {
+	Reason string `json:"reason"`
+	Limit  int64  `json:"limit"`
+	Field  string `json:"field,omitempty"`
+}
+
+func (e *LimitError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("HTTP request too large: %s of %s over %d", e.Reason, e.Field, e.Limit)
+	}
+	return fmt.Sprintf("HTTP request too large: %s over %d", e.Reason, e.Limit)
+}
+
+// New returns a middleware that limits request bodies by route and content
+// type. Requests announcing a larger Content-Length are rejected before the
+// body is read, the others fail while the handler reads past the limit.
+// With WithMultipart, multipart forms are parsed and checked up front.
+func New(opts ...Option) gin.HandlerFunc {
+	o := &option{
+		memory:   defaultMultipartMemory,
+		response: defaultResponse,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(c *gin.Context) {
+		c.Set(policyContextKey, o)
+		if limit := o.limitOf(c); limit > 0 {
+			if c.Request.ContentLength > limit {
+				o.reject(c, &LimitError{Reason: ReasonContentLength, Limit: limit})
+				return
+			}
+			limitBody(c, limit, ReasonBodySize, o.reject)
+		}
+		// compressed forms are checked by Decompress once inflated
+		if c.Request.Header.Get("Content-Encoding") == "" && !o.checkMultipart(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// Decompress wraps a gzip DecompressFn so the inflated body is capped by
+// WithDecompressedLimit and multipart forms are checked once inflated. Use it
+// behind New, as in gzip.WithDecompressFn(limits.Decompress(gzip.DefaultDecompressHandle)).
+func Decompress(fn func(c *gin.Context)) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		body := c.Request.Body
+		fn(c)
+		if c.IsAborted() || c.Request.Body == body {
+			return
+		}
+		val, ok := c.Get(policyContextKey)
+		if !ok {
+			return
+		}
+		o := val.(*option)
+		if o.decompressed > 0 {
+			limitBody(c, o.decompressed, ReasonDecompressed, o.reject)
+		}
+		o.checkMultipart(c)
+	}
+}
+
+// limitOf returns the route limit, else the content type limit, else the default
+func (o *option) limitOf(c *gin.Context) int64 {
+	if len(o.routes) > 0 {
+		if limit, ok := o.routes[routeKey(c.Request.Method, c.FullPath())]; ok {
+			return limit
+		}
+		if limit, ok := o.routes[routeKey(anyMethod, c.FullPath())]; ok {
+			return limit
+		}
+	}
+	if len(o.contentTypes) > 0 {
+		mediaType := mediaTypeOf(c.Request)
+		if limit, ok := o.contentTypes[mediaType]; ok {
+			return limit
+		}
+		if i := strings.IndexByte(mediaType, '/'); i > 0 {
+			if limit, ok := o.contentTypes[mediaType[:i]+"/*"]; ok {
+				return limit
+			}
+		}
+	}
+	return o.limit
+}
+
+// checkMultipart parses a multipart form and checks its files, it returns
+// false when the request was aborted
+func (o *option) checkMultipart(c *gin.Context) bool {
+	if o.maxFiles <= 0 && o.maxFileSize <= 0 && o.maxFilesSize <= 0 {
+		return true
+	}
+	if mediaTypeOf(c.Request) != "multipart/form-data" {
+		return true
+	}
+	limitErr, err := o.parseMultipart(c)
+	if limitErr != nil {
+		if c.Request.MultipartForm != nil {
+			_ = c.Request.MultipartForm.RemoveAll()
+		}
+		if !c.IsAborted() {
+			o.reject(c, limitErr)
+		}
+		return false
+	}
+	if err != nil {
+		if !c.IsAborted() {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+		}
+		return false
+	}
+	return true
+}
+
+// parseMultipart parses the form while scanning its parts on the side, the
+// scan stops the parser at the first part over a cap so the rest of the body
+// is never read
+func (o *option) parseMultipart(c *gin.Context) (*LimitError, error) {
+	_, params, _ := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if params["boundary"] == "" {
+		return nil, c.Request.ParseMultipartForm(o.memory)
+	}
+	pr, pw := io.Pipe()
+	var limitErr *LimitError
+	scanned := make(chan struct{})
+	go func() {
+		defer close(scanned)
+		if limitErr = o.scan(multipart.NewReader(pr, params["boundary"])); limitErr != nil {
+			_ = pr.CloseWithError(limitErr)
+			return
+		}
+		// the epilogue or a malformed part is left to the parser
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	body := c.Request.Body
+	c.Request.Body = &teeBody{Reader: io.TeeReader(body, pw), body: body}
+	err := c.Request.ParseMultipartForm(o.memory)
+	_ = pw.Close()
+	<-scanned
+	c.Request.Body = body
+	return limitErr, err
+}
+
+// scan reads the parts of a multipart body and returns the first cap a file
+// goes over
+func (o *option) scan(mr *multipart.Reader) *LimitError {
+	var count int
+	var total int64
+	buf := make([]byte, 32<<10)
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return nil
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		count++
+		if o.maxFiles > 0 && count > o.maxFiles {
+			return &LimitError{Reason: ReasonFileCount, Limit: int64(o.maxFiles)}
+		}
+		var size int64
+		for {
+			n, err := part.Read(buf)
+			size += int64(n)
+			total += int64(n)
+			if o.maxFileSize > 0 && size > o.maxFileSize {
+				return &LimitError{Reason: ReasonFileSize, Limit: o.maxFileSize, Field: part.FormName()}
+			}
+			if o.maxFilesSize > 0 && total > o.maxFilesSize {
+				return &LimitError{Reason: ReasonFilesSize, Limit: o.maxFilesSize}
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+}
+
+// teeBody copies what the form parser reads of body to the scan
+type teeBody struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+func (b *teeBody) Close() error {
+	return b.body.Close()
+}
+
+// reject records err, asks the client to close the connection and aborts
+// with the configured response
+func (o *option) reject(c *gin.Context, err *LimitError) {
+	_ = c.Error(err)
+	c.Header("connection", "close")
+	o.response(c, err)
+	c.Abort()
+}
+
+func defaultResponse(c *gin.Context, err *LimitError) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":  "request too large",
+		"detail": err,
+	})
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+func mediaTypeOf(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	}
+	return strings.ToLower(mediaType)
+}
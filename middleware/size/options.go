@@ -0,0 +1,89 @@
+package limits
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+const anyMethod = "*"
+
+// Option for the body limiter
+type Option func(*option)
+
+type option struct {
+	limit        int64
+	routes       map[string]int64
+	contentTypes map[string]int64
+	decompressed int64
+	maxFiles     int
+	maxFileSize  int64
+	maxFilesSize int64
+	memory       int64
+	response     func(c *gin.Context, err *LimitError)
+}
+
+// WithLimit set the body limit of requests without a route or content type limit
+func WithLimit(limit int64) Option {
+	return func(o *option) {
+		o.limit = limit
+	}
+}
+
+// WithRouteLimit set the body limit of a route template as returned by c.FullPath,
+// an empty or "*" method matches every method and a zero limit disables it.
+// A route limit takes precedence over content type limits.
+func WithRouteLimit(method, path string, limit int64) Option {
+	return func(o *option) {
+		if method == "" {
+			method = anyMethod
+		}
+		if o.routes == nil {
+			o.routes = map[string]int64{}
+		}
+		o.routes[routeKey(method, path)] = limit
+	}
+}
+
+// WithContentTypeLimit set the body limit of a media type such as
+// application/json, or of a whole type such as image/*
+func WithContentTypeLimit(contentType string, limit int64) Option {
+	return func(o *option) {
+		if o.contentTypes == nil {
+			o.contentTypes = map[string]int64{}
+		}
+		o.contentTypes[contentType] = limit
+	}
+}
+
+// WithMultipart parse multipart/form-data bodies up front and cap the number
+// of files, the size of each file and the size of all files, 0 means unlimited.
+// The body is not read past the first file over a cap.
+func WithMultipart(maxFiles int, maxFileSize int64, maxFilesSize int64) Option {
+	return func(o *option) {
+		o.maxFiles = maxFiles
+		o.maxFileSize = maxFileSize
+		o.maxFilesSize = maxFilesSize
+	}
+}
+
+// WithMultipartMemory set the bytes of a multipart form kept in memory, the
+// rest is stored in temporary files (default 32MB as in gin)
+func WithMultipartMemory(memory int64) Option {
+	return func(o *option) {
+		o.memory = memory
+	}
+}
+
+// WithDecompressedLimit cap the inflated body of compressed requests, it is
+// enforced by the DecompressFn wrapped with Decompress
+func WithDecompressedLimit(limit int64) Option {
+	return func(o *option) {
+		o.decompressed = limit
+	}
+}
+
+// WithResponse replace the 413 JSON response
+func WithResponse(fn func(c *gin.Context, err *LimitError)) Option {
+	return func(o *option) {
+		o.response = fn
+	}
+}
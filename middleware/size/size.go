@@ -1,7 +1,6 @@
 package limits
 
 import (
-	"fmt"
 	"io"
 	"net/http"
 
@@ -14,20 +13,16 @@ type maxBytesReader struct {
 	remaining  int64
 	wasAborted bool
 	sawEOF     bool
+	err        *LimitError
+	reject     func(c *gin.Context, err *LimitError)
 }
 
 func (mbr *maxBytesReader) tooLarge() (n int, err error) {
-	n, err = 0, fmt.Errorf("HTTP request too large")
-
 	if !mbr.wasAborted {
 		mbr.wasAborted = true
-		ctx := mbr.ctx
-		_ = ctx.Error(err)
-		ctx.Header("connection", "close")
-		ctx.String(http.StatusRequestEntityTooLarge, "request too large")
-		ctx.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		mbr.reject(mbr.ctx, mbr.err)
 	}
-	return
+	return 0, mbr.err
 }
 
 func (mbr *maxBytesReader) Read(p []byte) (n int, err error) {
@@ -70,6 +65,21 @@ func (mbr *maxBytesReader) Close() error {
 	return mbr.rdr.Close()
 }
 
+func limitBody(ctx *gin.Context, limit int64, reason string, reject func(c *gin.Context, err *LimitError)) {
+	if ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+		return
+	}
+	ctx.Request.Body = &maxBytesReader{
+		ctx:        ctx,
+		rdr:        ctx.Request.Body,
+		remaining:  limit,
+		wasAborted: false,
+		sawEOF:     false,
+		err:        &LimitError{Reason: reason, Limit: limit},
+		reject:     reject,
+	}
+}
+
 // RequestSizeLimiter returns a middleware that limits the size of request
 // When a request is over the limit, the following will happen:
 // * Error will be added to the context
@@ -77,14 +87,5 @@ func (mbr *maxBytesReader) Close() error {
 // * Error 413 will be sent to the client (http.StatusRequestEntityTooLarge)
 // * Current context will be aborted
 func RequestSizeLimiter(limit int64) gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		ctx.Request.Body = &maxBytesReader{
-			ctx:        ctx,
-			rdr:        ctx.Request.Body,
-			remaining:  limit,
-			wasAborted: false,
-			sawEOF:     false,
-		}
-		ctx.Next()
-	}
+	return New(WithLimit(limit))
 }
@@ -2,12 +2,18 @@ package limits
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	mgzip "github.com/donetkit/contrib-gin/middleware/gzip"
 	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestRequestSizeLimiterOK(t *testing.T) {
@@ -46,6 +52,181 @@ func TestRequestSizeLimiterOver(t *testing.T) {
 	}
 }
 
+func readHandler(c *gin.Context) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return
+	}
+	c.String(http.StatusOK, "%d", len(data))
+}
+
+func limitError(t *testing.T, w *httptest.ResponseRecorder) LimitError {
+	var body struct {
+		Error  string     `json:"error"`
+		Detail LimitError `json:"detail"`
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "request too large", body.Error)
+	return body.Detail
+}
+
+func TestContentLengthRejectedEarly(t *testing.T) {
+	read := false
+	router := gin.New()
+	router.Use(New(WithLimit(4)))
+	router.POST("/", func(c *gin.Context) {
+		read = true
+	})
+	resp := performRequest(http.MethodPost, "/", "big=abc", router)
+
+	assert.False(t, read)
+	assert.Equal(t, "close", resp.Header().Get("Connection"))
+	assert.Equal(t, LimitError{Reason: ReasonContentLength, Limit: 4}, limitError(t, resp))
+}
+
+func TestBodySizeWithoutContentLength(t *testing.T) {
+	router := gin.New()
+	router.Use(New(WithLimit(4)))
+	router.POST("/", readHandler)
+
+	r := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("big=abc")))
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, LimitError{Reason: ReasonBodySize, Limit: 4}, limitError(t, w))
+}
+
+func TestRouteAndContentTypeLimits(t *testing.T) {
+	router := gin.New()
+	router.Use(New(
+		WithLimit(4),
+		WithContentTypeLimit("application/json", 16),
+		WithContentTypeLimit("image/*", 64),
+		WithRouteLimit(http.MethodPost, "/upload/:name", 128),
+	))
+	router.POST("/json", readHandler)
+	router.POST("/upload/:name", readHandler)
+
+	post := func(path, contentType string, size int) int {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(strings.Repeat("a", size)))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post("/json", "application/json; charset=utf-8", 16))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/json", "application/json", 17))
+	assert.Equal(t, http.StatusOK, post("/json", "image/png", 64))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/json", "text/plain", 5))
+	assert.Equal(t, http.StatusOK, post("/upload/a", "application/json", 128))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/upload/a", "application/json", 129))
+}
+
+func multipartRequest(t *testing.T, files map[string]int) *http.Request {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	assert.NoError(t, mw.WriteField("name", "gin"))
+	for name, size := range files {
+		fw, err := mw.CreateFormFile(name, name+".txt")
+		assert.NoError(t, err)
+		_, _ = fw.Write(bytes.Repeat([]byte("a"), size))
+	}
+	assert.NoError(t, mw.Close())
+	r := httptest.NewRequest(http.MethodPost, "/", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestMultipartLimits(t *testing.T) {
+	router := gin.New()
+	router.Use(New(WithLimit(1<<20), WithMultipart(2, 10, 15)))
+	router.POST("/", func(c *gin.Context) {
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "%s %d", c.PostForm("name"), len(form.File))
+	})
+
+	cases := []struct {
+		files  map[string]int
+		reason string
+	}{
+		{files: map[string]int{"a": 10}},
+		{files: map[string]int{"a": 5, "b": 10}},
+		{files: map[string]int{"a": 11}, reason: ReasonFileSize},
+		{files: map[string]int{"a": 1, "b": 1, "c": 1}, reason: ReasonFileCount},
+		{files: map[string]int{"a": 8, "b": 8}, reason: ReasonFilesSize},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, multipartRequest(t, tc.files))
+		if tc.reason == "" {
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "gin "+string(rune('0'+len(tc.files))), w.Body.String())
+			continue
+		}
+		assert.Equal(t, tc.reason, limitError(t, w).Reason)
+	}
+}
+
+// countingBody counts the bytes read of a request body
+type countingBody struct {
+	io.Reader
+	n int
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.n += n
+	return n, err
+}
+
+func TestMultipartStopsReading(t *testing.T) {
+	router := gin.New()
+	router.Use(New(WithMultipart(0, 1<<10, 0)))
+	router.POST("/", readHandler)
+
+	r := multipartRequest(t, map[string]int{"a": 8 << 20})
+	body := &countingBody{Reader: r.Body}
+	r.Body = io.NopCloser(body)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, ReasonFileSize, limitError(t, w).Reason)
+	assert.Less(t, body.n, 1<<20, "the body is read past the file size cap")
+}
+
+func TestDecompressedLimit(t *testing.T) {
+	router := gin.New()
+	router.Use(New(WithLimit(1<<10), WithDecompressedLimit(1<<12)))
+	router.Use(mgzip.Gzip(mgzip.DefaultCompression, mgzip.WithDecompressFn(Decompress(mgzip.DefaultDecompressHandle))))
+	router.POST("/", readHandler)
+
+	post := func(size int) *httptest.ResponseRecorder {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		_, _ = gz.Write(bytes.Repeat([]byte("a"), size))
+		_ = gz.Close()
+		r := httptest.NewRequest(http.MethodPost, "/", buf)
+		r.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post(1 << 12)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "4096", w.Body.String())
+
+	w = post(1 << 16)
+	assert.Equal(t, LimitError{Reason: ReasonDecompressed, Limit: 1 << 12}, limitError(t, w))
+}
+
 func performRequest(method, target, body string, router *gin.Engine) *httptest.ResponseRecorder {
 	var buf *bytes.Buffer
 	if body != "" {
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/donetkit/contrib-log/glog"
 	"github.com/gin-gonic/gin"
 )
 
@@ -31,6 +32,58 @@ func WithResponse(h gin.HandlerFunc) Option {
 	}
 }
 
+// WithRouteTimeout set the timeout of a route template as returned by c.FullPath,
+// an empty or "*" method matches every method and a zero timeout disables it
+func WithRouteTimeout(method, path string, timeout time.Duration) Option {
+	return func(t *Timeout) {
+		if method == "" {
+			method = anyMethod
+		}
+		if t.routes == nil {
+			t.routes = map[string]time.Duration{}
+		}
+		t.routes[routeKey(method, path)] = timeout
+	}
+}
+
+// WithDeadlineHeader honour a client deadline sent in header, such as
+// X-Request-Timeout or grpc-timeout. grpc-timeout takes gRPC units such as 1S
+// or 200m, any other header Go durations such as 5m or plain seconds. It can
+// only shorten the server timeout.
+func WithDeadlineHeader(header string) Option {
+	return func(t *Timeout) {
+		t.deadlineHeader = header
+	}
+}
+
+// WithStreaming let handlers flush or hijack the response, for SSE and
+// websockets. Once they do, the timeout only bounds the time to the first
+// flush and each gap between writes, which may last up to idle (0 keeps the timeout).
+func WithStreaming(idle time.Duration) Option {
+	return func(t *Timeout) {
+		t.stream = true
+		t.idle = idle
+	}
+}
+
+// OverrunFunc is called once a handler that missed its deadline returns, with
+// the copy of the context the handler ran on and its total running time
+type OverrunFunc func(c *gin.Context, elapsed time.Duration)
+
+// WithOverrun set a hook for handlers still running past the deadline
+func WithOverrun(fn OverrunFunc) Option {
+	return func(t *Timeout) {
+		t.overrun = fn
+	}
+}
+
+// WithLogger log handlers still running past the deadline
+func WithLogger(logger glog.ILogger) Option {
+	return func(t *Timeout) {
+		t.logger = logger.WithField("Timeout", "Timeout")
+	}
+}
+
 func defaultResponse(c *gin.Context) {
 	c.String(http.StatusRequestTimeout, http.StatusText(http.StatusRequestTimeout))
 }
@@ -40,4 +93,12 @@ type Timeout struct {
 	timeout  time.Duration
 	handler  gin.HandlerFunc
 	response gin.HandlerFunc
+	overrun  OverrunFunc
+	logger   glog.ILoggerEntry
+
+	routes         map[string]time.Duration
+	deadlineHeader string
+
+	stream bool
+	idle   time.Duration
 }
@@ -0,0 +1,101 @@
+package timeout
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	anyMethod         = "*"
+	grpcTimeoutHeader = "grpc-timeout"
+)
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// budget returns the timeout of the request, the route policy capped by the
+// deadline the client sent
+func (t *Timeout) budget(c *gin.Context) time.Duration {
+	timeout := t.timeout
+	if len(t.routes) > 0 {
+		if d, ok := t.routes[routeKey(c.Request.Method, c.FullPath())]; ok {
+			timeout = d
+		} else if d, ok := t.routes[routeKey(anyMethod, c.FullPath())]; ok {
+			timeout = d
+		}
+	}
+	if timeout <= 0 || t.deadlineHeader == "" {
+		return timeout
+	}
+	grpc := strings.EqualFold(t.deadlineHeader, grpcTimeoutHeader)
+	if d, ok := parseTimeout(c.GetHeader(t.deadlineHeader), grpc); ok && d > 0 && d < timeout {
+		timeout = d
+	}
+	return timeout
+}
+
+// parseTimeout accepts grpc-timeout values such as 1S or 200m when grpc is
+// set, else Go durations such as 1.5s or 5m and plain seconds. Values that are
+// not positive or overflow a Duration are rejected, so a client cannot lift
+// the server timeout.
+func parseTimeout(s string, grpc bool) (time.Duration, bool) {
+	if grpc {
+		return parseGRPCTimeout(s)
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 && f < math.MaxInt64/float64(time.Second) {
+		if d := time.Duration(f * float64(time.Second)); d > 0 {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// parseGRPCTimeout parses a grpc-timeout value, at most 8 digits and a unit
+func parseGRPCTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+	if n, err := strconv.ParseInt(s[:len(s)-1], 10, 64); err == nil && n > 0 {
+		var unit time.Duration
+		switch s[len(s)-1] {
+		case 'H':
+			unit = time.Hour
+		case 'M':
+			unit = time.Minute
+		case 'S':
+			unit = time.Second
+		case 'm':
+			unit = time.Millisecond
+		case 'u':
+			unit = time.Microsecond
+		case 'n':
+			unit = time.Nanosecond
+		}
+		if unit > 0 {
+			if n > math.MaxInt64/int64(unit) {
+				return 0, false
+			}
+			return time.Duration(n) * unit, true
+		}
+	}
+	return 0, false
+}
+
+// Remaining returns the time left before the deadline of ctx. Outgoing http
+// and grpc calls made with the request context inherit the same deadline.
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
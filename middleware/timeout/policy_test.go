@@ -0,0 +1,119 @@
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		grpc  bool
+		want  time.Duration
+		ok    bool
+	}{
+		{"1S", true, time.Second, true},
+		{"200m", true, 200 * time.Millisecond, true},
+		{"2M", true, 2 * time.Minute, true},
+		{"1500u", true, 1500 * time.Microsecond, true},
+		{"1.5s", true, 0, false},
+		{"1S", false, 0, false},
+		{"1.5s", false, 1500 * time.Millisecond, true},
+		{"300ms", false, 300 * time.Millisecond, true},
+		// a Go duration of minutes, not gRPC milliseconds
+		{"5m", false, 5 * time.Minute, true},
+		{"3", false, 3 * time.Second, true},
+		{"0.25", false, 250 * time.Millisecond, true},
+		{"", false, 0, false},
+		{"", true, 0, false},
+		{"0", false, 0, false},
+		{"-1s", false, 0, false},
+		{"soon", false, 0, false},
+		// values overflowing a Duration must not lift the timeout
+		{"1e10", false, 0, false},
+		{"1e300", false, 0, false},
+		{"99999999H", true, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTimeout(tt.value, tt.grpc)
+		assert.Equal(t, tt.ok, ok, tt.value)
+		assert.Equal(t, tt.want, got, tt.value)
+	}
+}
+
+func budgetHandler(c *gin.Context) {
+	remaining, ok := Remaining(c.Request.Context())
+	if !ok {
+		c.String(http.StatusOK, "none")
+		return
+	}
+	c.String(http.StatusOK, remaining.Round(time.Second).String())
+}
+
+func TestRouteTimeout(t *testing.T) {
+	r := gin.New()
+	r.Use(New(
+		WithTimeout(10*time.Second),
+		WithRouteTimeout(http.MethodGet, "/users/:id", 5*time.Second),
+		WithRouteTimeout("", "/export", 0),
+		WithDeadlineHeader("X-Request-Timeout"),
+	))
+	r.GET("/users/:id", budgetHandler)
+	r.GET("/export", budgetHandler)
+	r.GET("/", budgetHandler)
+
+	for _, tt := range []struct {
+		path   string
+		header string
+		want   string
+	}{
+		{"/", "", "10s"},
+		{"/users/1", "", "5s"},
+		{"/users/1", "2s", "2s"},
+		{"/users/1", "30s", "5s"},
+		{"/users/1", "5m", "5s"},
+		{"/users/1", "1e300", "5s"},
+		{"/users/1", "2S", "5s"},
+		{"/export", "2s", "none"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), "GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("X-Request-Timeout", tt.header)
+		}
+		r.ServeHTTP(w, req)
+		assert.Equal(t, tt.want, w.Body.String(), tt.path)
+	}
+}
+
+func TestGRPCTimeoutHeader(t *testing.T) {
+	r := gin.New()
+	r.Use(New(WithTimeout(10*time.Second), WithDeadlineHeader("Grpc-Timeout")))
+	r.GET("/", budgetHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	req.Header.Set("grpc-timeout", "2S")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "2s", w.Body.String())
+}
+
+func TestMiddlewareTimeout(t *testing.T) {
+	r := gin.New()
+	r.Use(New(WithTimeout(20 * time.Millisecond)))
+	r.GET("/", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+}
@@ -0,0 +1,77 @@
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func streamResponse(gap time.Duration, events int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		for i := 0; i < events; i++ {
+			if _, err := c.Writer.WriteString("data: ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+			time.Sleep(gap)
+		}
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	r := gin.New()
+	r.GET("/", New(
+		WithTimeout(50*time.Millisecond),
+		WithHandler(streamResponse(10*time.Millisecond, 10)),
+		WithStreaming(0),
+	))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, 10, len(w.Body.String())/len("data: ping\n\n"))
+	assert.True(t, w.Flushed)
+}
+
+func TestStreamingIdle(t *testing.T) {
+	r := gin.New()
+	r.GET("/", New(
+		WithTimeout(time.Second),
+		WithHandler(streamResponse(80*time.Millisecond, 3)),
+		WithStreaming(30*time.Millisecond),
+	))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "data: ping\n\n", w.Body.String())
+}
+
+func TestStreamingFirstByte(t *testing.T) {
+	r := gin.New()
+	r.GET("/", New(
+		WithTimeout(20*time.Millisecond),
+		WithHandler(func(c *gin.Context) {
+			time.Sleep(50 * time.Millisecond)
+			streamResponse(0, 1)(c)
+		}),
+		WithStreaming(time.Second),
+	))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+}
@@ -1,19 +1,26 @@
 package timeout
 
 import (
+	"bytes"
+	"context"
+	"github.com/donetkit/contrib-gin/internal/ginctx"
 	"github.com/donetkit/contrib/utils/buffer"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-var bufPool *buffer.Pool
+var bufPool = &buffer.Pool{}
 
 const (
 	defaultTimeout = 5 * time.Second
 )
 
-// New wraps a handler and aborts the process of the handler if the timeout is reached
+// New wraps a handler and aborts the process of the handler if the timeout is reached.
+// The handler runs on a copy of the context whose request context is cancelled
+// at the deadline, so database and rpc calls made with it return early.
+// Without WithHandler it is a middleware that only sets the deadline on the
+// request context for the rest of the chain.
 func New(opts ...Option) gin.HandlerFunc {
 	t := &Timeout{
 		timeout:  defaultTimeout,
@@ -31,64 +38,190 @@ func New(opts ...Option) gin.HandlerFunc {
 		opt(t)
 	}
 
-	if t.timeout <= 0 {
+	if t.timeout <= 0 && len(t.routes) == 0 {
 		return t.handler
 	}
 
-	bufPool = &buffer.Pool{}
-
 	return func(c *gin.Context) {
+		timeout := t.budget(c)
+		if timeout <= 0 {
+			if t.handler != nil {
+				t.handler(c)
+			}
+			return
+		}
+
+		if t.handler == nil {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+			defer cancel()
+			t.deadline(ctx, c)
+			return
+		}
+
+		// a streaming handler is bounded by the timer below, not by a deadline
+		idle := t.idle
+		if idle <= 0 {
+			idle = timeout
+		}
+		var ctx context.Context
+		var cancel context.CancelFunc
+		var expired <-chan time.Time
+		if t.stream {
+			ctx, cancel = context.WithCancel(c.Request.Context())
+			timer := time.NewTimer(minDuration(timeout, idle))
+			defer timer.Stop()
+			expired = timer.C
+		} else {
+			ctx, cancel = context.WithTimeout(c.Request.Context(), timeout)
+		}
+		defer cancel()
+
 		finish := make(chan struct{}, 1)
 		panicChan := make(chan interface{}, 1)
 
 		w := c.Writer
 		buffer := bufPool.Get()
 		tw := NewWriter(w, buffer)
-		c.Writer = tw
+		tw.stream = t.stream
 		buffer.Reset()
 
+		// the handler never touches c, which keeps running the chain after a timeout
+		cp := ginctx.Copy(c)
+		tracked := !cp.IsAborted()
+		cp.Request = c.Request.WithContext(ctx)
+		cp.Writer = tw
+
+		start := time.Now()
 		go func() {
 			defer func() {
-				if p := recover(); p != nil {
+				p := recover()
+				if tw.finish(start, timeout) {
+					t.overrunning(cp, time.Since(start), p)
+					return
+				}
+				if p != nil {
 					panicChan <- p
+					return
 				}
+				finish <- struct{}{}
 			}()
-			t.handler(c)
-			finish <- struct{}{}
+			t.handler(cp)
 		}()
 
-		select {
-		case p := <-panicChan:
-			tw.FreeBuffer()
-			c.Writer = w
-			panic(p)
-
-		case <-finish:
-			c.Next()
-			tw.mu.Lock()
-			defer tw.mu.Unlock()
-			dst := tw.ResponseWriter.Header()
-			for k, vv := range tw.Header() {
-				dst[k] = vv
+	wait:
+		for {
+			select {
+			case p := <-panicChan:
+				tw.FreeBuffer()
+				panic(p)
+
+			case <-finish:
+				t.commit(c, cp, tracked && cp.IsAborted(), w, tw, buffer)
+				return
+
+			case <-expired:
+				remaining, bounded := tw.idle(idle, timeout-time.Since(start))
+				if !bounded {
+					expired = nil
+					continue
+				}
+				if remaining > 0 {
+					expired = time.After(minDuration(remaining, idle))
+					continue
+				}
+				break wait
+
+			case <-ctx.Done():
+				break wait
 			}
-			tw.ResponseWriter.WriteHeader(tw.code)
-			if _, err := tw.ResponseWriter.Write(buffer.Bytes()); err != nil {
-				panic(err)
+		}
+
+		if !tw.expire() {
+			// the handler returned just before the deadline
+			select {
+			case p := <-panicChan:
+				tw.FreeBuffer()
+				panic(p)
+			case <-finish:
+				t.commit(c, cp, tracked && cp.IsAborted(), w, tw, buffer)
 			}
-			tw.FreeBuffer()
-			bufPool.Put(buffer)
-
-		case <-time.After(t.timeout):
-			c.Abort()
-			tw.mu.Lock()
-			defer tw.mu.Unlock()
-			tw.timeout = true
-			tw.FreeBuffer()
-			bufPool.Put(buffer)
-
-			c.Writer = w
+			return
+		}
+
+		c.Abort()
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.FreeBuffer()
+		bufPool.Put(buffer)
+
+		cancel()
+		if !tw.streaming {
 			t.response(c)
-			c.Writer = tw
 		}
 	}
 }
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// deadline runs the rest of the chain cooperatively on c, answering with the
+// timeout response if the chain gave up after the deadline without writing
+func (t *Timeout) deadline(ctx context.Context, c *gin.Context) {
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+	if ctx.Err() == context.DeadlineExceeded && !c.Writer.Written() {
+		c.Abort()
+		t.response(c)
+	}
+}
+
+// commit runs the rest of the chain, unless the handler aborted, and writes
+// the buffered response of a handler that finished in time
+func (t *Timeout) commit(c *gin.Context, cp *gin.Context, aborted bool, w gin.ResponseWriter, tw *Writer, buffer *bytes.Buffer) {
+	for k, v := range cp.Keys {
+		c.Set(k, v)
+	}
+	c.Errors = append(c.Errors, cp.Errors...)
+	if aborted {
+		c.Abort()
+	} else {
+		c.Writer = tw
+		c.Next()
+		c.Writer = w
+	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.streaming {
+		tw.FreeBuffer()
+		bufPool.Put(buffer)
+		return
+	}
+	dst := tw.ResponseWriter.Header()
+	for k, vv := range tw.Header() {
+		dst[k] = vv
+	}
+	tw.ResponseWriter.WriteHeader(tw.code)
+	if _, err := tw.ResponseWriter.Write(buffer.Bytes()); err != nil {
+		panic(err)
+	}
+	tw.FreeBuffer()
+	bufPool.Put(buffer)
+}
+
+// overrunning reports a handler that returned or panicked after its deadline
+func (t *Timeout) overrunning(c *gin.Context, elapsed time.Duration, p interface{}) {
+	if t.logger != nil {
+		if p != nil {
+			t.logger.Warningf("%s %s panicked after timeout %s: %v", c.Request.Method, c.Request.URL.Path, elapsed, p)
+		} else {
+			t.logger.Warningf("%s %s finished after timeout %s", c.Request.Method, c.Request.URL.Path, elapsed)
+		}
+	}
+	if t.overrun != nil {
+		t.overrun(c, elapsed)
+	}
+}
@@ -100,3 +100,89 @@ func TestPanic(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "", w.Body.String())
 }
+
+func TestContextCancelled(t *testing.T) {
+	done := make(chan time.Duration, 1)
+	cancelled := make(chan error, 1)
+	r := gin.New()
+	r.GET("/", New(
+		WithTimeout(20*time.Millisecond),
+		WithHandler(func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			cancelled <- c.Request.Context().Err()
+			c.String(http.StatusOK, "too late")
+		}),
+		WithOverrun(func(c *gin.Context, elapsed time.Duration) {
+			done <- elapsed
+		}),
+	))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.Equal(t, context.DeadlineExceeded, <-cancelled)
+	assert.GreaterOrEqual(t, <-done, 20*time.Millisecond)
+}
+
+func TestKeysPropagated(t *testing.T) {
+	r := gin.New()
+	r.GET("/", New(
+		WithTimeout(time.Second),
+		WithHandler(func(c *gin.Context) {
+			c.Set("user", "gin")
+			c.String(http.StatusOK, "")
+		}),
+	), func(c *gin.Context) {
+		c.Header("X-User", c.GetString("user"))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gin", w.Header().Get("X-User"))
+}
+
+func TestAbortPropagated(t *testing.T) {
+	r := gin.New()
+	r.GET("/", New(
+		WithTimeout(time.Second),
+		WithHandler(func(c *gin.Context) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}),
+	), func(c *gin.Context) {
+		c.String(http.StatusOK, "secret")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+}
+
+func TestFullPath(t *testing.T) {
+	paths := make(chan string, 2)
+	r := gin.New()
+	r.GET("/users/:id", New(
+		WithTimeout(20*time.Millisecond),
+		WithHandler(func(c *gin.Context) {
+			paths <- c.FullPath()
+			<-c.Request.Context().Done()
+		}),
+		WithOverrun(func(c *gin.Context, elapsed time.Duration) {
+			paths <- c.FullPath()
+		}),
+	))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/users/1", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, "/users/:id", <-paths)
+	assert.Equal(t, "/users/:id", <-paths)
+}
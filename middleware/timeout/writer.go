@@ -1,14 +1,21 @@
 package timeout
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// ErrNotStreaming is returned by Hijack unless the middleware runs WithStreaming
+var ErrNotStreaming = errors.New("timeout: hijack requires streaming mode")
+
 // Writer is a writer with memory buffer
 type Writer struct {
 	gin.ResponseWriter
@@ -18,6 +25,13 @@ type Writer struct {
 	timeout      bool
 	wroteHeaders bool
 	code         int
+
+	// stream allows the handler to switch to pass-through by flushing or hijacking
+	stream    bool
+	streaming bool
+	hijacked  bool
+	lastWrite time.Time
+	done      bool
 }
 
 // NewWriter will return a timeout.Writer pointer
@@ -27,27 +41,144 @@ func NewWriter(w gin.ResponseWriter, buf *bytes.Buffer) *Writer {
 
 // Write will write data to response body
 func (w *Writer) Write(data []byte) (int, error) {
-	if w.timeout || w.body == nil {
-		return 0, nil
-	}
-
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if w.streaming {
+		if w.timeout {
+			return 0, http.ErrHandlerTimeout
+		}
+		w.lastWrite = time.Now()
+		return w.ResponseWriter.Write(data)
+	}
+	if w.timeout || w.body == nil {
+		return 0, nil
+	}
 	return w.body.Write(data)
 }
 
 // WriteHeader will write http status code
 func (w *Writer) WriteHeader(code int) {
 	checkWriteHeaderCode(code)
-	if w.timeout || w.wroteHeaders {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timeout || w.wroteHeaders || w.streaming {
 		return
 	}
+	w.writeHeader(code)
+}
 
+// WriteHeaderNow fixes the status code, it is sent with the buffered body
+// unless the writer streams
+func (w *Writer) WriteHeaderNow() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	w.writeHeader(code)
+	if w.timeout || w.hijacked {
+		return
+	}
+	if w.streaming {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	if !w.wroteHeaders {
+		code := w.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+		w.writeHeader(code)
+	}
+}
+
+// Flush switches a streaming writer to pass-through and flushes it, it does
+// nothing while the response is buffered
+func (w *Writer) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.stream || w.timeout || w.hijacked {
+		return
+	}
+	w.passThrough()
+	w.ResponseWriter.Flush()
+	w.lastWrite = time.Now()
+}
+
+// Hijack hands the connection to the handler, after which the timeout no longer applies
+func (w *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.stream {
+		return nil, nil, ErrNotStreaming
+	}
+	if w.timeout {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	w.streaming = true
+	w.hijacked = true
+	return w.ResponseWriter.Hijack()
+}
+
+// passThrough sends the buffered response, later writes go straight to the
+// client. It must be called with mu held.
+func (w *Writer) passThrough() {
+	if w.streaming {
+		return
+	}
+	w.streaming = true
+	dst := w.ResponseWriter.Header()
+	for k, vv := range w.headers {
+		dst[k] = vv
+	}
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	if w.body != nil && w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+// idle returns how long the handler may still stay silent, firstByte while
+// nothing was flushed yet. bounded is false once the connection was hijacked.
+func (w *Writer) idle(timeout time.Duration, firstByte time.Duration) (wait time.Duration, bounded bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.hijacked {
+		return 0, false
+	}
+	if !w.streaming {
+		return firstByte, true
+	}
+	return timeout - time.Since(w.lastWrite), true
+}
+
+// finish marks the handler as returned and reports whether it missed its deadline
+func (w *Writer) finish(start time.Time, timeout time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.streaming && time.Since(start) >= timeout {
+		w.timeout = true
+	}
+	w.done = !w.timeout
+	return w.timeout
+}
+
+// expire marks the handler as timed out, unless it already returned in time
+func (w *Writer) expire() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.done {
+		return false
+	}
+	w.timeout = true
+	return true
 }
 
 func (w *Writer) writeHeader(code int) {
@@ -60,6 +191,39 @@ func (w *Writer) Header() http.Header {
 	return w.headers
 }
 
+// Status returns the buffered http status code
+func (w *Writer) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// Size returns the number of buffered body bytes
+func (w *Writer) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.streaming {
+		return w.ResponseWriter.Size()
+	}
+	if w.body == nil {
+		return 0
+	}
+	return w.body.Len()
+}
+
+// Written reports whether the handler wrote a status code or body
+func (w *Writer) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.wroteHeaders || w.streaming || (w.body != nil && w.body.Len() > 0)
+}
+
 // WriteString will write string to response body
 func (w *Writer) WriteString(s string) (int, error) {
 	return w.Write([]byte(s))
@@ -21,3 +21,9 @@ func TestWriteHeader(t *testing.T) {
 		writer.WriteHeader(code2)
 	})
 }
+
+func TestHijackRequiresStreaming(t *testing.T) {
+	writer := Writer{}
+	_, _, err := writer.Hijack()
+	assert.Equal(t, ErrNotStreaming, err)
+}
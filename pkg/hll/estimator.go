@@ -0,0 +1,274 @@
+package hll
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/donetkit/contrib/utils/cache"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultPrefix       = "hll"
+	defaultSyncInterval = 30 * time.Second
+)
+
+// Window is a rolling window of Size, made of Slots sketches. Its estimate
+// covers the last Size, at the precision of one slot.
+type Window struct {
+	Name  string
+	Size  time.Duration
+	Slots int
+}
+
+var (
+	// Hourly is the last hour, in slots of five minutes
+	Hourly = Window{Name: "1h", Size: time.Hour, Slots: 12}
+	// Daily is the last day, in slots of one hour
+	Daily = Window{Name: "1d", Size: 24 * time.Hour, Slots: 24}
+)
+
+type slot struct {
+	sketch *Sketch
+	dirty  bool
+}
+
+type window struct {
+	Window
+	width int64
+	slots map[int64]*slot
+	// remote are the sketches of the other replicas merged by slot, as of
+	// the last Sync
+	remote map[int64]*Sketch
+}
+
+func newWindow(w Window) *window {
+	if w.Slots <= 0 {
+		w.Slots = 1
+	}
+	width := int64(w.Size) / int64(w.Slots)
+	if width <= 0 {
+		width = 1
+	}
+	return &window{Window: w, width: width, slots: map[int64]*slot{}}
+}
+
+// Estimator counts distinct visitors over rolling windows. It is a
+// prometheus.Collector exporting one gauge per window, labelled by the
+// window name. With WithCache the sketches of every replica are merged on
+// each Sync, a scrape does not read the cache.
+type Estimator struct {
+	namespace    string
+	name         string
+	windows      []*window
+	store        cache.ICache
+	prefix       string
+	replica      string
+	syncInterval time.Duration
+	now          func() time.Time
+	desc         *prometheus.Desc
+
+	mu        sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewEstimator returns an Estimator, Close stops the cache sync
+func NewEstimator(opts ...Option) *Estimator {
+	host, _ := os.Hostname()
+	e := &Estimator{
+		namespace:    "service",
+		name:         "unique_visitors",
+		windows:      []*window{newWindow(Hourly), newWindow(Daily)},
+		prefix:       defaultPrefix,
+		replica:      host + "-" + strconv.Itoa(os.Getpid()),
+		syncInterval: defaultSyncInterval,
+		now:          time.Now,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.desc = prometheus.NewDesc(
+		prometheus.BuildFQName(e.namespace, "", e.name),
+		"Estimated number of distinct visitors over the rolling window.",
+		[]string{"window"}, nil,
+	)
+	if e.store != nil && e.syncInterval > 0 {
+		go e.run()
+	} else {
+		close(e.done)
+	}
+	return e
+}
+
+// Add counts a visit of visitor, such as a client IP
+func (e *Estimator) Add(visitor string) {
+	if visitor == "" {
+		return
+	}
+	now := e.now().UnixNano()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, w := range e.windows {
+		idx := now / w.width
+		s, ok := w.slots[idx]
+		if !ok {
+			s = &slot{sketch: NewSketch()}
+			w.slots[idx] = s
+			for i := range w.slots {
+				if i <= idx-int64(w.Slots) {
+					delete(w.slots, i)
+				}
+			}
+		}
+		s.sketch.Add(visitor)
+		s.dirty = true
+	}
+}
+
+// Estimate returns the distinct visitors of the named window, merged with
+// the other replicas as of the last Sync, and false for an unknown window
+func (e *Estimator) Estimate(name string) (uint64, bool) {
+	for _, w := range e.windows {
+		if w.Name == name {
+			return e.estimate(w), true
+		}
+	}
+	return 0, false
+}
+
+func (e *Estimator) estimate(w *window) uint64 {
+	last := e.now().UnixNano() / w.width
+	first := last - int64(w.Slots) + 1
+	merged := NewSketch()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := first; i <= last; i++ {
+		if s, ok := w.slots[i]; ok {
+			merged.Merge(s.sketch)
+		}
+		if s, ok := w.remote[i]; ok {
+			merged.Merge(s)
+		}
+	}
+	return merged.Estimate()
+}
+
+// Sync stores the sketches changed since the last sync in the cache, where
+// they expire once out of their window, and loads the sketches of the other
+// replicas, in a single pipeline. It runs every sync interval until Close.
+func (e *Estimator) Sync() {
+	if e.store == nil {
+		return
+	}
+	ctx := context.Background()
+	pipe := e.store.Pipeline()
+	var written []*slot
+	reads := map[*window]map[int64]*redis.StringStringMapCmd{}
+	now := e.now().UnixNano()
+	e.mu.Lock()
+	for _, w := range e.windows {
+		for i, s := range w.slots {
+			if !s.dirty {
+				continue
+			}
+			data, _ := s.sketch.MarshalBinary()
+			key := e.key(w, i)
+			pipe.HSet(ctx, key, e.replica, base64.StdEncoding.EncodeToString(data))
+			// a slot leaves the window at most Size after it was written
+			pipe.Expire(ctx, key, w.Size)
+			s.dirty = false
+			written = append(written, s)
+		}
+		last := now / w.width
+		reads[w] = map[int64]*redis.StringStringMapCmd{}
+		for i := last - int64(w.Slots) + 1; i <= last; i++ {
+			reads[w][i] = pipe.HGetAll(ctx, e.key(w, i))
+		}
+	}
+	e.mu.Unlock()
+	if _, err := pipe.Exec(ctx); err != nil {
+		// write the sketches again on the next sync
+		e.mu.Lock()
+		for _, s := range written {
+			s.dirty = true
+		}
+		e.mu.Unlock()
+		return
+	}
+	remotes := map[*window]map[int64]*Sketch{}
+	for w, cmds := range reads {
+		remotes[w] = map[int64]*Sketch{}
+		for i, cmd := range cmds {
+			for replica, data := range cmd.Val() {
+				if replica == e.replica {
+					continue
+				}
+				raw, err := base64.StdEncoding.DecodeString(data)
+				sketch := NewSketch()
+				if err != nil || sketch.UnmarshalBinary(raw) != nil {
+					continue
+				}
+				if merged, ok := remotes[w][i]; ok {
+					merged.Merge(sketch)
+				} else {
+					remotes[w][i] = sketch
+				}
+			}
+		}
+	}
+	e.mu.Lock()
+	for w, remote := range remotes {
+		w.remote = remote
+	}
+	e.mu.Unlock()
+}
+
+// Close stops the cache sync after a last Sync
+func (e *Estimator) Close() {
+	e.closeOnce.Do(func() {
+		close(e.stop)
+	})
+	<-e.done
+}
+
+func (e *Estimator) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.Sync()
+		case <-e.stop:
+			e.Sync()
+			return
+		}
+	}
+}
+
+// key is the cache hash of a slot, its fields are the replicas
+func (e *Estimator) key(w *window, idx int64) string {
+	return fmt.Sprintf("%s:%s:%s:%d", e.prefix, e.name, w.Name, idx)
+}
+
+// Describe implements prometheus.Collector
+func (e *Estimator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.desc
+}
+
+// Collect implements prometheus.Collector
+func (e *Estimator) Collect(ch chan<- prometheus.Metric) {
+	for _, w := range e.windows {
+		ch <- prometheus.MustNewConstMetric(e.desc, prometheus.GaugeValue, float64(e.estimate(w)), w.Name)
+	}
+}
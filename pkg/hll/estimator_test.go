@@ -0,0 +1,169 @@
+package hll
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib/utils/cache"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// hashStore is the part of cache.ICache the estimator uses
+type hashStore struct {
+	cache.ICache
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+	ttls   map[string]time.Duration
+	reads  int
+}
+
+func newHashStore() *hashStore {
+	return &hashStore{hashes: map[string]map[string]string{}, ttls: map[string]time.Duration{}}
+}
+
+func (s *hashStore) Pipeline() redis.Pipeliner {
+	return &hashPipeline{store: s}
+}
+
+// hashPipeline runs the commands on the store as they are queued
+type hashPipeline struct {
+	redis.Pipeliner
+	store *hashStore
+}
+
+func (p *hashPipeline) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+	if p.store.hashes[key] == nil {
+		p.store.hashes[key] = map[string]string{}
+	}
+	for i := 0; i+1 < len(values); i += 2 {
+		p.store.hashes[key][values[i].(string)] = values[i+1].(string)
+	}
+	return redis.NewIntCmd(ctx)
+}
+
+func (p *hashPipeline) Expire(ctx context.Context, key string, ttl time.Duration) *redis.BoolCmd {
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+	p.store.ttls[key] = ttl
+	return redis.NewBoolCmd(ctx)
+}
+
+func (p *hashPipeline) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+	p.store.reads++
+	all := map[string]string{}
+	for k, v := range p.store.hashes[key] {
+		all[k] = v
+	}
+	cmd := redis.NewStringStringMapCmd(ctx)
+	cmd.SetVal(all)
+	return cmd
+}
+
+func (p *hashPipeline) Exec(context.Context) ([]redis.Cmder, error) {
+	return nil, nil
+}
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestEstimator(c *clock, opts ...Option) *Estimator {
+	e := NewEstimator(opts...)
+	e.now = c.Now
+	return e
+}
+
+func TestEstimatorWindows(t *testing.T) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	e := newTestEstimator(c)
+	defer e.Close()
+	for i := 0; i < 100; i++ {
+		e.Add("a" + strconv.Itoa(i))
+	}
+	c.Add(30 * time.Minute)
+	for i := 0; i < 100; i++ {
+		e.Add("b" + strconv.Itoa(i))
+	}
+	hourly, _ := e.Estimate("1h")
+	assert.InDelta(t, 200, hourly, 4)
+
+	c.Add(45 * time.Minute)
+	e.Add("c")
+	hourly, _ = e.Estimate("1h")
+	daily, _ := e.Estimate("1d")
+	assert.InDelta(t, 101, hourly, 2)
+	assert.InDelta(t, 201, daily, 4)
+
+	_, ok := e.Estimate("1w")
+	assert.False(t, ok)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(e))
+}
+
+func TestEstimatorReplicas(t *testing.T) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := newHashStore()
+	a := newTestEstimator(c, WithCache(store, ""), WithReplica("a"), WithWindows(Hourly), WithSyncInterval(0))
+	b := newTestEstimator(c, WithCache(store, ""), WithReplica("b"), WithWindows(Hourly), WithSyncInterval(0))
+	defer a.Close()
+	defer b.Close()
+
+	for i := 0; i < 50; i++ {
+		a.Add(strconv.Itoa(i))
+		b.Add(strconv.Itoa(i + 25))
+	}
+	a.Sync()
+	b.Sync()
+	// the sketch of b is seen from the next sync of a
+	estimate, _ := a.Estimate("1h")
+	assert.InDelta(t, 50, estimate, 2)
+	a.Sync()
+	estimate, _ = a.Estimate("1h")
+	assert.InDelta(t, 75, estimate, 2)
+
+	// slots expire in the cache once out of the window
+	assert.Len(t, store.ttls, 1)
+	for _, ttl := range store.ttls {
+		assert.Equal(t, time.Hour, ttl)
+	}
+
+	// a scrape does not read the cache
+	reads := store.reads
+	assert.Equal(t, 1, testutil.CollectAndCount(a))
+	assert.Equal(t, reads, store.reads)
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(a))
+}
+
+func TestEstimatorNarrowWindow(t *testing.T) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	e := newTestEstimator(c, WithWindows(Window{Name: "tiny", Size: 5, Slots: 10}))
+	defer e.Close()
+	e.Add("a")
+	estimate, _ := e.Estimate("tiny")
+	assert.Equal(t, uint64(1), estimate)
+}
@@ -0,0 +1,115 @@
+/*
+Package hll estimates the number of distinct values, such as client IPs,
+with HyperLogLog sketches.
+
+A Sketch takes 16KB whatever the number of values added, with a standard
+error of about 0.8%. Sketches of the same precision merge losslessly, so
+replicas can count separately and merge their sketches.
+
+Estimator keeps sketches for rolling windows, such as the last hour and the
+last day, exports them as prometheus gauges, and merges the sketches other
+replicas store in a cache.ICache.
+*/
+package hll
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	precision = 14
+	registers = 1 << precision
+	version   = 1
+)
+
+// ErrInvalidSketch is returned when unmarshalling data that is not a sketch
+var ErrInvalidSketch = errors.New("hll: invalid sketch")
+
+// Sketch is a HyperLogLog sketch, it is not safe for concurrent use
+type Sketch struct {
+	reg [registers]uint8
+}
+
+// NewSketch returns an empty sketch
+func NewSketch() *Sketch {
+	return &Sketch{}
+}
+
+// Add adds a value to the sketch
+func (s *Sketch) Add(value string) {
+	h := hash(value)
+	idx := h >> (64 - precision)
+	rho := uint8(bits.LeadingZeros64(h<<precision|1<<(precision-1))) + 1
+	if rho > s.reg[idx] {
+		s.reg[idx] = rho
+	}
+}
+
+// Merge adds the values of other to the sketch
+func (s *Sketch) Merge(other *Sketch) {
+	for i, r := range other.reg {
+		if r > s.reg[i] {
+			s.reg[i] = r
+		}
+	}
+}
+
+// Estimate returns the estimated number of distinct values added
+func (s *Sketch) Estimate() uint64 {
+	const m = float64(registers)
+	var sum float64
+	var zeros int
+	for _, r := range s.reg {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// small cardinalities are better estimated by linear counting
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Reset empties the sketch
+func (s *Sketch) Reset() {
+	s.reg = [registers]uint8{}
+}
+
+// MarshalBinary encodes the sketch
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 2+registers)
+	data[0] = version
+	data[1] = precision
+	copy(data[2:], s.reg[:])
+	return data, nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) != 2+registers || data[0] != version || data[1] != precision {
+		return ErrInvalidSketch
+	}
+	copy(s.reg[:], data[2:])
+	return nil
+}
+
+// hash is 64 bit FNV-1a followed by the murmur3 finalizer, it must stay the
+// same on every replica for their sketches to merge
+func hash(value string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(value); i++ {
+		h ^= uint64(value[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
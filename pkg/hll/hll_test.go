@@ -0,0 +1,46 @@
+package hll
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketchEstimate(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		s := NewSketch()
+		for i := 0; i < n; i++ {
+			s.Add("10.0." + strconv.Itoa(i))
+			s.Add("10.0." + strconv.Itoa(i))
+		}
+		assert.InDelta(t, n, s.Estimate(), float64(n)*0.02+1, "n=%d", n)
+	}
+}
+
+func TestSketchMerge(t *testing.T) {
+	a, b := NewSketch(), NewSketch()
+	for i := 0; i < 20000; i++ {
+		a.Add(strconv.Itoa(i))
+		b.Add(strconv.Itoa(i + 10000))
+	}
+	a.Merge(b)
+	assert.InDelta(t, 30000, a.Estimate(), 600)
+}
+
+func TestSketchMarshal(t *testing.T) {
+	s := NewSketch()
+	for i := 0; i < 5000; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+	data, err := s.MarshalBinary()
+	assert.NoError(t, err)
+
+	decoded := NewSketch()
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, s.Estimate(), decoded.Estimate())
+	assert.Equal(t, ErrInvalidSketch, decoded.UnmarshalBinary(data[:100]))
+
+	s.Reset()
+	assert.Equal(t, uint64(0), s.Estimate())
+}
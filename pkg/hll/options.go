@@ -0,0 +1,62 @@
+package hll
+
+import (
+	"time"
+
+	"github.com/donetkit/contrib/utils/cache"
+)
+
+// Option for NewEstimator
+type Option func(*Estimator)
+
+// WithNamespace set the namespace of the gauge (default "service")
+func WithNamespace(namespace string) Option {
+	return func(e *Estimator) {
+		e.namespace = namespace
+	}
+}
+
+// WithName set the name of the gauge (default "unique_visitors")
+func WithName(name string) Option {
+	return func(e *Estimator) {
+		e.name = name
+	}
+}
+
+// WithWindows set the rolling windows (default Hourly and Daily)
+func WithWindows(windows ...Window) Option {
+	return func(e *Estimator) {
+		e.windows = e.windows[:0]
+		for _, w := range windows {
+			e.windows = append(e.windows, newWindow(w))
+		}
+	}
+}
+
+// WithCache share the sketches with the other replicas through store, under
+// keys starting with prefix (default "hll"). The store must support Pipeline,
+// such as the redis cache.
+func WithCache(store cache.ICache, prefix string) Option {
+	return func(e *Estimator) {
+		e.store = store
+		if prefix != "" {
+			e.prefix = prefix
+		}
+	}
+}
+
+// WithReplica set the name of this replica in the cache (default the host
+// name and the process id), it must be unique across replicas
+func WithReplica(replica string) Option {
+	return func(e *Estimator) {
+		e.replica = replica
+	}
+}
+
+// WithSyncInterval set how often the sketches are stored in the cache
+// (default 30s)
+func WithSyncInterval(interval time.Duration) Option {
+	return func(e *Estimator) {
+		e.syncInterval = interval
+	}
+}